@@ -0,0 +1,139 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "fmt"
+import "strconv"
+import "strings"
+
+// The access rights of a DESFire file. Each access right is either a key
+// number (0 to 13), Free, or Deny. The zero value grants all access rights
+// to key 0 only.
+//
+// The textual representation used by String() and ParseDESFireAccessRights()
+// lists the four access rights as
+//
+//	R:1 W:2 RW:free C:0
+//
+// where each value is a key number, "free", or "deny". A DESFireAccessRights
+// marshals to and from this representation with encoding.TextMarshaler, so
+// access rights in JSON or other text based configuration files are human
+// readable.
+type DESFireAccessRights struct {
+	Read      byte // read access
+	Write     byte // write access
+	ReadWrite byte // read and write access
+	Change    byte // change access rights
+}
+
+// Return the access rights as the uint16 used by the tag. This is the same as
+// calling MakeDESFireAccessRights().
+func (ar DESFireAccessRights) Marshal() uint16 {
+	return MakeDESFireAccessRights(ar.Read, ar.Write, ar.ReadWrite, ar.Change)
+}
+
+// Set ar to the access rights described by the uint16 used by the tag.
+func (ar *DESFireAccessRights) Unmarshal(b uint16) {
+	ar.Read, ar.Write, ar.ReadWrite, ar.Change = SplitDESFireAccessRights(b)
+}
+
+// Format a single access right.
+func formatAccessRight(key byte) string {
+	switch key {
+	case Free:
+		return "free"
+	case Deny:
+		return "deny"
+	default:
+		return strconv.Itoa(int(key))
+	}
+}
+
+// Return the textual representation of ar, e.g. "R:1 W:2 RW:free C:0".
+func (ar DESFireAccessRights) String() string {
+	return "R:" + formatAccessRight(ar.Read) +
+		" W:" + formatAccessRight(ar.Write) +
+		" RW:" + formatAccessRight(ar.ReadWrite) +
+		" C:" + formatAccessRight(ar.Change)
+}
+
+// Parse access rights in the textual representation produced by String().
+// The four access rights may appear in any order separated by white space;
+// names and values are case insensitive. Access rights not mentioned are set
+// to Deny.
+func ParseDESFireAccessRights(s string) (DESFireAccessRights, error) {
+	ar := DESFireAccessRights{Deny, Deny, Deny, Deny}
+	seen := map[string]bool{}
+
+	for _, field := range strings.Fields(s) {
+		i := strings.IndexByte(field, ':')
+		if i < 0 {
+			return DESFireAccessRights{}, fmt.Errorf("freefare: invalid access right %q", field)
+		}
+
+		name, value := strings.ToUpper(field[:i]), strings.ToLower(field[i+1:])
+		if seen[name] {
+			return DESFireAccessRights{}, fmt.Errorf("freefare: duplicate access right %q", field)
+		}
+
+		seen[name] = true
+
+		var key byte
+		switch value {
+		case "free":
+			key = Free
+		case "deny":
+			key = Deny
+		default:
+			n, err := strconv.ParseUint(value, 10, 8)
+			if err != nil || n > 13 {
+				return DESFireAccessRights{}, fmt.Errorf("freefare: invalid key number in access right %q", field)
+			}
+
+			key = byte(n)
+		}
+
+		switch name {
+		case "R":
+			ar.Read = key
+		case "W":
+			ar.Write = key
+		case "RW":
+			ar.ReadWrite = key
+		case "C":
+			ar.Change = key
+		default:
+			return DESFireAccessRights{}, fmt.Errorf("freefare: unknown access right %q", field)
+		}
+	}
+
+	return ar, nil
+}
+
+// Implement encoding.TextMarshaler.
+func (ar DESFireAccessRights) MarshalText() ([]byte, error) {
+	return []byte(ar.String()), nil
+}
+
+// Implement encoding.TextUnmarshaler.
+func (ar *DESFireAccessRights) UnmarshalText(text []byte) error {
+	parsed, err := ParseDESFireAccessRights(string(text))
+	if err != nil {
+		return err
+	}
+
+	*ar = parsed
+	return nil
+}
@@ -18,14 +18,15 @@ package freefare
 import "C"
 import "unsafe"
 
-// Create a new application with AID aid, settings and keyNo authentication
-// keys. Authentication keys are set to 0 after creation. This wrapper does not
+// Create a new application with AID aid and key settings settings, including
+// settings.MaxKeys authentication keys of cryptography mode settings.Crypto.
+// Authentication keys are set to 0 after creation. This wrapper does not
 // wrap the functions mifare_desfire_create_application_3k3des() and
-// mifare_desfire_create_application_aes(). Or keyNo with the constants
-// CRYPTO_3K3DES and CRYPTO_AES instead.
-func (t DESFireTag) CreateApplication(aid DESFireAid, settings, keyNo byte) error {
+// mifare_desfire_create_application_aes(). Set settings.Crypto instead.
+func (t DESFireTag) CreateApplication(aid DESFireAid, settings DESFireKeySettings) error {
 	r, err := C.mifare_desfire_create_application(
-		t.ctag, aid.cptr(), C.uint8_t(settings), C.uint8_t(keyNo))
+		t.ctag, aid.cptr(), C.uint8_t(settings.Marshal()),
+		C.uint8_t(settings.MarshalMaxKeys()))
 	if r != 0 {
 		return t.TranslateError(err)
 	}
@@ -33,16 +34,14 @@ func (t DESFireTag) CreateApplication(aid DESFireAid, settings, keyNo byte) erro
 	return nil
 }
 
-// Create a new application with AID aid, settings, keyNo authentication keys,
-// and, if wantIsoFileIdentifiers is true, an ISO file ID and an optional file
-// name isoFileName. This wrapper does not wrap the functions
+// Create a new application with AID aid, key settings settings, and, if
+// wantIsoFileIdentifiers is true, an ISO file ID and an optional file name
+// isoFileName. This wrapper does not wrap the functions
 // mifare_desfire_create_application_3k3des_iso and
-// mifare_desfire_create_application_aes_iso(). Or keyNo with the constants
-// CRYPTO_3K3DES and CRYPTO_AES instead.
+// mifare_desfire_create_application_aes_iso(). Set settings.Crypto instead.
 func (t DESFireTag) CreateApplicationIso(
 	aid DESFireAid,
-	settings byte,
-	keyNo byte,
+	settings DESFireKeySettings,
 	wantIsoFileIdentifiers bool,
 	isoFileID uint16,
 	isoFileName []byte,
@@ -55,8 +54,8 @@ func (t DESFireTag) CreateApplicationIso(
 	r, err := C.mifare_desfire_create_application_iso(
 		t.ctag,
 		aid.cptr(),
-		C.uint8_t(settings),
-		C.uint8_t(keyNo),
+		C.uint8_t(settings.Marshal()),
+		C.uint8_t(settings.MarshalMaxKeys()),
 		wifi,
 		C.uint16_t(isoFileID),
 		(*C.uint8_t)(&isoFileName[0]),
@@ -70,15 +69,24 @@ func (t DESFireTag) CreateApplicationIso(
 
 // Delete the application identified by aid
 func (t DESFireTag) DeleteApplication(aid DESFireAid) error {
+	t.forgetFiles()
 	r, err := C.mifare_desfire_delete_application(t.ctag, aid.cptr())
 	if r != 0 {
 		return t.TranslateError(err)
 	}
 
+	// deleting the selected application selects the PICC
+	if s := t.Session(); s.Selected && s.AID == aid {
+		t.dropSession()
+		t.selected(NewDESFireAid(0))
+	}
+
 	return nil
 }
 
-// Return a list of all applications of the card
+// Return a list of all applications of the card. DESFire Light tags do not
+// support this command as they have only one fixed application; use
+// DESFireTag.Light() to access them.
 func (t DESFireTag) ApplicationIds() ([]DESFireAid, error) {
 	var count C.size_t
 	var caids *C.MifareDESFireAID
@@ -102,10 +110,14 @@ func (t DESFireTag) ApplicationIds() ([]DESFireAid, error) {
 // Select an application. After Connect(), the master application is selected.
 // This function can be used to select a different application.
 func (t DESFireTag) SelectApplication(aid DESFireAid) error {
+	t.dropSession()
+	t.unselected()
+	t.forgetFiles()
 	r, err := C.mifare_desfire_select_application(t.ctag, aid.cptr())
 	if r != 0 {
 		return t.TranslateError(err)
 	}
 
+	t.selected(aid)
 	return nil
 }
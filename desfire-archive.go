@@ -0,0 +1,352 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "fmt"
+
+// A backup of the applications and files of a DESFire card as made by
+// Export(), meant to be stored as JSON and restored to another card with
+// Import(). Keys are not part of the archive; they are obtained from a
+// KeyProvider.
+type CardArchive struct {
+	Applications []ApplicationArchive `json:"applications"`
+}
+
+// The backup of one application.
+type ApplicationArchive struct {
+	AID         uint32             `json:"aid"`
+	KeySettings DESFireKeySettings `json:"key_settings"`
+	Files       []FileArchive      `json:"files"`
+}
+
+// The backup of one file. The embedded FileLayout describes the file, its
+// Data and Value fields hold the content of data and value files. Records
+// holds the records of record files, oldest first. If the content of the
+// file could not be read because of its access rights, Unreadable is set and
+// the file is restored empty; for value files, Value is set to LowerLimit as
+// the tag refuses to create a value file with a value outside its limits.
+// Files of a type the wrapper does not know have
+// both Unreadable and Unsupported set; they are not restored.
+type FileArchive struct {
+	FileLayout
+	Records     [][]byte `json:"records,omitempty"`
+	Unreadable  bool     `json:"unreadable,omitempty"`
+	Unsupported bool     `json:"unsupported,omitempty"`
+}
+
+// Return the files of a whose content could not be read as strings of the
+// form "AID/file", e.g. "012345/3". An empty result means that a is a
+// complete backup of the card.
+func (a *CardArchive) Unreadable() []string {
+	var unreadable []string
+	for i := range a.Applications {
+		app := &a.Applications[i]
+		for j := range app.Files {
+			if app.Files[j].Unreadable {
+				unreadable = append(unreadable, fmt.Sprintf("%06x/%d", app.AID, app.Files[j].FileNo))
+			}
+		}
+	}
+
+	return unreadable
+}
+
+// Return the layout of a, i.e. its applications and files with the content
+// of data and value files, but without records and unsupported files.
+func (a *CardArchive) Layout() *CardLayout {
+	layout := CardLayout{Applications: make([]ApplicationLayout, len(a.Applications))}
+	for i := range a.Applications {
+		app := &a.Applications[i]
+		al := ApplicationLayout{
+			AID:         app.AID,
+			KeySettings: app.KeySettings,
+			Files:       make([]FileLayout, 0, len(app.Files)),
+		}
+
+		for j := range app.Files {
+			if !app.Files[j].Unsupported {
+				al.Files = append(al.Files, app.Files[j].FileLayout)
+			}
+		}
+
+		layout.Applications[i] = al
+	}
+
+	return &layout
+}
+
+// Return the name of file type ft as used in FileLayout.Type.
+func fileTypeName(ft byte) string {
+	for name, t := range layoutFileTypes {
+		if t == ft {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("type:%d", ft)
+}
+
+// Return the FileLayout of file fileNo with settings fs, without content.
+func layoutFromSettings(fileNo byte, fs *DESFireFileSettings) FileLayout {
+	f := FileLayout{
+		FileNo:       fileNo,
+		Type:         fileTypeName(fs.FileType),
+		Comm:         commName(fs.CommunicationSettings),
+		AccessRights: fs.AccessRights,
+	}
+
+	switch fs.FileType {
+	case StandardDataFile, BackupDataFile:
+		f.Size = fs.FileSize
+	case ValueFileWithBackup:
+		f.LowerLimit = fs.LowerLimit
+		f.UpperLimit = fs.UpperLimit
+		f.LimitedCredit = fs.LimitedCreditEnabled&1 != 0
+	case LinearRecordFileWithBackup, CyclicRecordFileWithBackup:
+		f.RecordSize = fs.RecordSize
+		f.MaxRecords = fs.MaxNumberOfRecords
+	}
+
+	return f
+}
+
+// Make a backup of all applications of t including key settings, file
+// settings, and file contents. keys provides the PICC master key (if
+// needed) and the keys of each application: Export() authenticates with key
+// 0 of each application and, where a file's access rights demand it, with
+// the read or read-write key of the file. Files whose content the tag still
+// refuses to give out or whose type the wrapper does not know are marked
+// Unreadable, see CardArchive.Unreadable(); all other errors abort the
+// export. The limited credit value of value
+// files and the ISO file identifiers of applications are not preserved. The
+// PICC is selected when Export() returns.
+func (t DESFireTag) Export(keys KeyProvider) (*CardArchive, error) {
+	err := t.selectPICC(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	aids, err := t.ApplicationIds()
+	if err != nil {
+		return nil, err
+	}
+
+	archive := CardArchive{Applications: make([]ApplicationArchive, 0, len(aids))}
+	for _, aid := range aids {
+		app, err := t.exportApplication(aid, keys)
+		if err != nil {
+			return nil, err
+		}
+
+		archive.Applications = append(archive.Applications, *app)
+	}
+
+	err = t.SelectApplication(NewDESFireAid(0))
+	if err != nil {
+		return nil, err
+	}
+
+	return &archive, nil
+}
+
+// Select application aid, authenticate with its key 0, and make a backup of
+// it.
+func (t DESFireTag) exportApplication(aid DESFireAid, keys KeyProvider) (*ApplicationArchive, error) {
+	err := t.SelectApplication(aid)
+	if err != nil {
+		return nil, err
+	}
+
+	master, err := keys.Key(aid, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if master != nil {
+		err = t.Authenticate(0, *master)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ks, err := t.KeySettings()
+	if err != nil {
+		return nil, err
+	}
+
+	fileNos, err := t.FileIds()
+	if err != nil {
+		return nil, err
+	}
+
+	app := ApplicationArchive{
+		AID:         aid.Aid(),
+		KeySettings: ks,
+		Files:       make([]FileArchive, 0, len(fileNos)),
+	}
+
+	for _, fileNo := range fileNos {
+		fs, err := t.FileSettings(fileNo)
+		fa := FileArchive{FileLayout: layoutFromSettings(fileNo, &fs)}
+		switch {
+		case err == nil:
+			ar := fs.AccessRights
+			err = t.withFileAccess(aid, keys, []byte{ar.Read, ar.ReadWrite}, func() error {
+				return t.exportContent(&fa, &fs)
+			})
+		case err != Error(UnknownFileType):
+			return nil, err
+		}
+
+		switch {
+		case err == nil:
+		case err == Error(UnknownFileType):
+			fa.Unreadable = true
+			fa.Unsupported = true
+		case isDenied(err):
+			fa.Unreadable = true
+			if fs.FileType == ValueFileWithBackup {
+				fa.Value = fa.LowerLimit
+			}
+
+		default:
+			return nil, err
+		}
+
+		app.Files = append(app.Files, fa)
+	}
+
+	return &app, nil
+}
+
+// Read the content of the file described by fa with settings fs into fa.
+func (t DESFireTag) exportContent(fa *FileArchive, fs *DESFireFileSettings) error {
+	var err error
+	switch fs.FileType {
+	case StandardDataFile, BackupDataFile:
+		fa.Data, err = t.ReadFile(fa.FileNo)
+	case ValueFileWithBackup:
+		fa.Value, err = t.Value(fa.FileNo)
+	case LinearRecordFileWithBackup, CyclicRecordFileWithBackup:
+		fa.Records, err = t.ReadAllRecords(fa.FileNo)
+	default:
+		err = Error(UnknownFileType)
+	}
+
+	return err
+}
+
+// Restore archive to the blank card t: create its applications and files
+// with ApplyLayout(), then write the records of record files in their
+// original order. keys provides the keys of t, which may differ from those
+// of the card archive was exported from. Import() fails without changing
+// anything if one of the applications of archive already exists on t. Files
+// marked Unreadable are created empty, those marked Unsupported are skipped.
+// The PICC is selected when Import() returns.
+func (t DESFireTag) Import(archive *CardArchive, keys KeyProvider) error {
+	err := t.selectPICC(keys)
+	if err != nil {
+		return err
+	}
+
+	aids, err := t.ApplicationIds()
+	if err != nil {
+		return err
+	}
+
+	existing := map[uint32]bool{}
+	for _, aid := range aids {
+		existing[aid.Aid()] = true
+	}
+
+	for i := range archive.Applications {
+		if existing[archive.Applications[i].AID] {
+			return fmt.Errorf("freefare: application %06x already exists", archive.Applications[i].AID)
+		}
+	}
+
+	err = t.ApplyLayout(archive.Layout(), keys)
+	if err != nil {
+		return err
+	}
+
+	for i := range archive.Applications {
+		err = t.importRecords(&archive.Applications[i], keys)
+		if err != nil {
+			return err
+		}
+	}
+
+	return t.SelectApplication(NewDESFireAid(0))
+}
+
+// Write the records of the record files of app to the freshly created
+// application app.AID.
+func (t DESFireTag) importRecords(app *ApplicationArchive, keys KeyProvider) error {
+	selected := false
+	aid := NewDESFireAid(app.AID)
+	for i := range app.Files {
+		fa := &app.Files[i]
+		if len(fa.Records) == 0 {
+			continue
+		}
+
+		if !selected {
+			err := t.SelectApplication(aid)
+			if err != nil {
+				return err
+			}
+
+			master, err := keys.Key(aid, 0)
+			if err != nil {
+				return err
+			}
+
+			if master == nil {
+				return fmt.Errorf("freefare: no master key for application %06x", app.AID)
+			}
+
+			err = t.Authenticate(0, *master)
+			if err != nil {
+				return err
+			}
+
+			selected = true
+		}
+
+		ar := fa.AccessRights
+		err := t.withFileAccess(aid, keys, []byte{ar.Write, ar.ReadWrite}, func() error {
+			rf, err := t.OpenRecordFile(fa.FileNo)
+			if err != nil {
+				return err
+			}
+
+			for _, record := range fa.Records {
+				err = rf.Append(record)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
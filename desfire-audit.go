@@ -0,0 +1,195 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "crypto/hmac"
+import "crypto/sha256"
+import "encoding/binary"
+import "encoding/hex"
+import "fmt"
+
+// Size of the parts of an audit log record: counter, event length, link to
+// the previous record, and the truncated MAC.
+const (
+	auditCounterSize = 4
+	auditLengthSize  = 1
+	auditLinkSize    = 4
+	auditMACSize     = 8
+	auditOverhead    = auditCounterSize + auditLengthSize + auditLinkSize + auditMACSize
+)
+
+// A tamper-evident log kept in a record file of a DESFire tag, created with
+// OpenAuditLog(). Each record holds a counter (4 bytes, little endian), the
+// length of the event (1 byte), the event padded with zeroes, the first 4
+// bytes of the MAC of the previous record (all zeroes for the first record),
+// and the first 8 bytes of an HMAC-SHA256 under a host key over the rest of
+// the record. The MAC also covers the real UID of the card (see CardUID()),
+// the AID of the application, and the number of the file holding the log, so
+// a valid log cannot be transplanted to another card, application, or file.
+//
+// The access rights of the record file only control who may append to the
+// log. As the host key never goes onto the card, a holder of the write key
+// can clear the file or append records, but cannot produce records that pass
+// Verify(). The log is meant to be kept in a cyclic record file: once it is
+// full, the oldest records are overwritten and Verify() checks the chain from
+// the oldest record still present. Replacing the log with an older copy of
+// itself (by clearing the file and writing back earlier records) cannot be
+// detected from the card alone; compare the counter of the last entry with a
+// value kept on the host for that.
+type AuditLog struct {
+	file    *DESFireRecordFile
+	key     []byte
+	binding []byte // card UID, AID, and file number
+}
+
+// A verified entry of an AuditLog.
+type AuditEntry struct {
+	Counter uint32
+	Event   []byte
+}
+
+// Open the audit log kept in record file fileNo of the selected application
+// with the HMAC key key. The record size of the file must be larger than 17
+// bytes, the fixed part of a record; the rest of the record is available for
+// the event, but no more than 255 bytes. As the MAC covers the real UID of the
+// card and the AID, the tag must be authenticated for CardUID() and the
+// selected application must be known to Session(); a TagStateError is
+// returned otherwise.
+func (t DESFireTag) OpenAuditLog(fileNo byte, key []byte) (*AuditLog, error) {
+	session := t.Session()
+	if !session.Selected {
+		return nil, Error(TagStateError)
+	}
+
+	uid, err := t.CardUID()
+	if err != nil {
+		return nil, err
+	}
+
+	binding, err := hex.DecodeString(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	binding = append(binding, session.AID[:]...)
+	binding = append(binding, fileNo)
+
+	file, err := t.OpenRecordFile(fileNo)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.RecordSize() <= auditOverhead {
+		return nil, Error(LengthError)
+	}
+
+	return &AuditLog{file, key, binding}, nil
+}
+
+// Return the maximum length of an event.
+func (l *AuditLog) MaxEventSize() int {
+	n := l.file.RecordSize() - auditOverhead
+	if n > 255 {
+		n = 255
+	}
+
+	return n
+}
+
+// Compute the MAC of record rec (without its MAC), bound to the card UID,
+// AID, and file number of the log.
+func (l *AuditLog) mac(rec []byte) []byte {
+	h := hmac.New(sha256.New, l.key)
+	h.Write(l.binding)
+	h.Write(rec)
+	return h.Sum(nil)[:auditMACSize]
+}
+
+// Append event to the log and commit the transaction, unless called from
+// within Transaction(). The counter and link of the new record are taken
+// from the most recent record, which is not verified; call Verify() for
+// that. An event longer than MaxEventSize() causes a LengthError.
+func (l *AuditLog) Append(event []byte) error {
+	if len(event) > l.MaxEventSize() {
+		return Error(LengthError)
+	}
+
+	last, err := l.file.Latest(1)
+	if err != nil {
+		return err
+	}
+
+	rec := make([]byte, l.file.RecordSize())
+	body := rec[:len(rec)-auditMACSize]
+	link := body[len(body)-auditLinkSize:]
+	if len(last) > 0 {
+		prev := last[0]
+		binary.LittleEndian.PutUint32(rec, binary.LittleEndian.Uint32(prev)+1)
+		copy(link, prev[len(prev)-auditMACSize:])
+	}
+
+	rec[auditCounterSize] = byte(len(event))
+	copy(rec[auditCounterSize+auditLengthSize:], event)
+	copy(rec[len(body):], l.mac(body))
+
+	return l.file.Append(rec)
+}
+
+// Read all records left in the log, check their counters, links, and MACs,
+// and return them in chronological order. Each record must carry a valid
+// MAC, the counters must increase by one from record to record, and each
+// record must link to the MAC of the record before it, so missing,
+// reordered, modified, and forged records are detected. If verification
+// fails, the entries verified up to the offending record are returned along
+// with an error.
+func (l *AuditLog) Verify() ([]AuditEntry, error) {
+	records, err := l.file.Latest(l.file.MaxRecords())
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]AuditEntry, 0, len(records))
+	for i, rec := range records {
+		body := rec[:len(rec)-auditMACSize]
+		link := body[len(body)-auditLinkSize:]
+		counter := binary.LittleEndian.Uint32(rec)
+
+		if !hmac.Equal(rec[len(body):], l.mac(body)) {
+			return entries, fmt.Errorf("freefare: audit log: record %d (counter %d) has an invalid MAC", i, counter)
+		}
+
+		if i > 0 {
+			prev := records[i-1]
+			if counter != entries[i-1].Counter+1 {
+				return entries, fmt.Errorf("freefare: audit log: record %d has counter %d, expected %d",
+					i, counter, entries[i-1].Counter+1)
+			}
+
+			if !hmac.Equal(link, prev[len(prev)-auditMACSize:][:auditLinkSize]) {
+				return entries, fmt.Errorf("freefare: audit log: record %d (counter %d) does not chain to its predecessor", i, counter)
+			}
+		}
+
+		n := int(rec[auditCounterSize])
+		event := body[auditCounterSize+auditLengthSize : len(body)-auditLinkSize]
+		if n > len(event) {
+			return entries, fmt.Errorf("freefare: audit log: record %d (counter %d) has an invalid length", i, counter)
+		}
+
+		entries = append(entries, AuditEntry{counter, event[:n]})
+	}
+
+	return entries, nil
+}
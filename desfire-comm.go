@@ -0,0 +1,135 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+// What the wrapper remembers about a file of the selected application to
+// pick the communication mode: its communication settings, its access
+// rights, and the record size of record files. None of these change until
+// the file settings are changed or the file is deleted.
+type fileModes struct {
+	comm       byte
+	rights     DESFireAccessRights
+	recordSize int
+}
+
+// Return a copy of t that uses communication mode mode for both reading and
+// writing, overriding the automatic selection. Pass Default to go back to
+// the automatic selection. This is meant to be used for single operations:
+//
+//	n, err := t.Comm(Enciphered).ReadData(fileNo, 0, buf)
+func (t DESFireTag) Comm(mode byte) DESFireTag {
+	t.ReadSettings = mode
+	t.WriteSettings = mode
+	return t
+}
+
+// Find what is needed to pick the communication modes of file fileNo of the
+// selected application, calling FileSettings() if it is not cached yet.
+func (t DESFireTag) fileModes(fileNo byte) (fileModes, error) {
+	if t.state != nil {
+		if fm, ok := t.state.files[fileNo]; ok {
+			return fm, nil
+		}
+	}
+
+	fs, err := t.FileSettings(fileNo)
+	if err != nil {
+		return fileModes{}, err
+	}
+
+	fm := fileModes{
+		comm:       fs.CommunicationSettings,
+		rights:     fs.AccessRights,
+		recordSize: int(fs.RecordSize),
+	}
+
+	if t.state != nil {
+		if t.state.files == nil {
+			t.state.files = make(map[byte]fileModes)
+		}
+
+		t.state.files[fileNo] = fm
+	}
+
+	return fm, nil
+}
+
+// Return the communication mode of the file described by fm for an access
+// granted by the access rights keyNos. Like the libfreefare, use the
+// communication settings of the file if the tag is authenticated with one of
+// keyNos and plain communication otherwise, i.e. for free access without
+// authentication or with another key.
+func (t DESFireTag) fileMode(fm fileModes, keyNos ...byte) byte {
+	s := t.Session()
+	if s.Protocol != AuthLegacy {
+		return Plain
+	}
+
+	for _, keyNo := range keyNos {
+		if s.KeyNo == keyNo {
+			return fm.comm
+		}
+	}
+
+	return Plain
+}
+
+// Return the communication mode for reading from file fileNo: t.ReadSettings
+// unless it is Default, the mode found by fileMode() for the read and
+// read-write access rights otherwise.
+func (t DESFireTag) readMode(fileNo byte) (byte, error) {
+	if t.ReadSettings != Default {
+		return t.ReadSettings, nil
+	}
+
+	fm, err := t.fileModes(fileNo)
+	if err != nil {
+		return Plain, err
+	}
+
+	return t.fileMode(fm, fm.rights.Read, fm.rights.ReadWrite), nil
+}
+
+// Return the communication mode for writing to file fileNo: t.WriteSettings
+// unless it is Default, the mode found by fileMode() for the write and
+// read-write access rights otherwise.
+func (t DESFireTag) writeMode(fileNo byte) (byte, error) {
+	if t.WriteSettings != Default {
+		return t.WriteSettings, nil
+	}
+
+	fm, err := t.fileModes(fileNo)
+	if err != nil {
+		return Plain, err
+	}
+
+	return t.fileMode(fm, fm.rights.Write, fm.rights.ReadWrite), nil
+}
+
+// Forget the cached communication modes of file fileNo, e.g. because its
+// settings changed.
+func (t DESFireTag) forgetFile(fileNo byte) {
+	if t.state != nil {
+		delete(t.state.files, fileNo)
+	}
+}
+
+// Forget the cached communication modes of all files, e.g. because a
+// different application was selected.
+func (t DESFireTag) forgetFiles() {
+	if t.state != nil {
+		t.state.files = nil
+	}
+}
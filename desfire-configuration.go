@@ -0,0 +1,256 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+// #include <freefare.h>
+import "C"
+import "encoding/binary"
+
+// Options of the SetConfiguration command
+const (
+	ConfigPICC              = 0x00
+	ConfigDefaultKey        = 0x01
+	ConfigATS               = 0x02
+	ConfigSAK               = 0x03
+	ConfigSecureMessaging   = 0x04
+	ConfigCapabilities      = 0x05
+	ConfigVC                = 0x06
+	ConfigATQA              = 0x07
+	ConfigFailedAuthCounter = 0x0a
+	ConfigHardware          = 0x0b
+)
+
+// An option of the SetConfiguration command as applied with Configure().
+// This package provides types for the options with a known layout; use
+// RawConfiguration for the others.
+type DESFireConfiguration interface {
+	// Return option number and data of the SetConfiguration command.
+	Configuration() (option byte, data []byte)
+}
+
+// Option 00h (EV1 and later): PICC configuration.
+type PICCConfiguration struct {
+	DisableFormat bool // FormatPICC() is permanently disabled
+	RandomUID     bool // the tag answers with a random UID (irreversible)
+}
+
+// Option 01h (EV1 and later): the default key and key version that new keys
+// are set to. DES, 2K3DES, and AES keys occupy the first 16 bytes of Key,
+// the rest must be zero.
+type DefaultKeyConfiguration struct {
+	Key     [24]byte
+	Version byte
+}
+
+// Option 02h (EV1 and later): the ATS returned on selection, starting with
+// the length byte TL, which must be the length of the whole ATS.
+type ATSConfiguration struct {
+	ATS []byte
+}
+
+// Option 03h (EV2 and later): the SAK returned in cascade levels 1 and 2.
+type SAKConfiguration struct {
+	SAK1, SAK2 byte
+}
+
+// Option 04h (EV2 and later): secure messaging configuration, the 2 byte
+// SMConfig field. DisableChainedWriting rejects WriteData, WriteRecord, and
+// UpdateRecord commands split over several frames in Maced and Enciphered
+// mode (bit 2). Other holds the remaining bits, whose meaning depends on the
+// product; they are sent as is.
+type SecureMessagingConfiguration struct {
+	DisableChainedWriting bool
+	Other                 uint16
+}
+
+// Option 05h (EV2 and later): capability data. Setting LRP permanently
+// switches the tag to LRP secure messaging; this is how NTAG 424 DNA tags
+// are switched to LRP mode.
+type CapabilityConfiguration struct {
+	LRP bool
+}
+
+// Option 06h (EV2 and later): virtual card configuration, the VCConfig byte
+// of the PICC. Its bits are assigned by the data sheet of the product.
+type VCConfiguration struct {
+	VCConfig byte
+}
+
+// Option 07h (EV2 and later): the ATQA returned during anticollision.
+type ATQAConfiguration struct {
+	ATQA [2]byte
+}
+
+// Option 0Ah (EV2 and later): the failed authentication counter. If
+// enabled, the tag counts failed authentications and permanently disables
+// the key once Limit is reached; each successful authentication decrements
+// the counter by Decrement.
+type FailedAuthCounterConfiguration struct {
+	Enabled   bool
+	Limit     uint16
+	Decrement uint16
+}
+
+// Any option given as raw data. Use this for options without a type of
+// their own, such as 0Bh (hardware configuration), whose data layout
+// depends on the product.
+type RawConfiguration struct {
+	Option byte
+	Data   []byte
+}
+
+// Implement DESFireConfiguration.
+func (c PICCConfiguration) Configuration() (byte, []byte) {
+	var b byte
+	if c.DisableFormat {
+		b |= 0x01
+	}
+
+	if c.RandomUID {
+		b |= 0x02
+	}
+
+	return ConfigPICC, []byte{b}
+}
+
+// Implement DESFireConfiguration.
+func (c DefaultKeyConfiguration) Configuration() (byte, []byte) {
+	return ConfigDefaultKey, append(c.Key[:], c.Version)
+}
+
+// Implement DESFireConfiguration.
+func (c ATSConfiguration) Configuration() (byte, []byte) {
+	return ConfigATS, c.ATS
+}
+
+// Implement DESFireConfiguration.
+func (c SAKConfiguration) Configuration() (byte, []byte) {
+	return ConfigSAK, []byte{c.SAK1, c.SAK2}
+}
+
+// Implement DESFireConfiguration.
+func (c SecureMessagingConfiguration) Configuration() (byte, []byte) {
+	smConfig := c.Other
+	if c.DisableChainedWriting {
+		smConfig |= 0x0004
+	}
+
+	data := make([]byte, 2)
+	binary.LittleEndian.PutUint16(data, smConfig)
+	return ConfigSecureMessaging, data
+}
+
+// Implement DESFireConfiguration.
+func (c CapabilityConfiguration) Configuration() (byte, []byte) {
+	// 4 RFU bytes, PDCap2.1 to PDCap2.6
+	data := make([]byte, 10)
+	if c.LRP {
+		data[4] = 0x02
+	}
+
+	return ConfigCapabilities, data
+}
+
+// Implement DESFireConfiguration.
+func (c VCConfiguration) Configuration() (byte, []byte) {
+	return ConfigVC, []byte{c.VCConfig}
+}
+
+// Implement DESFireConfiguration.
+func (c ATQAConfiguration) Configuration() (byte, []byte) {
+	return ConfigATQA, c.ATQA[:]
+}
+
+// Implement DESFireConfiguration.
+func (c FailedAuthCounterConfiguration) Configuration() (byte, []byte) {
+	data := make([]byte, 5)
+	if c.Enabled {
+		data[0] = 0x01
+	}
+
+	binary.LittleEndian.PutUint16(data[1:3], c.Limit)
+	binary.LittleEndian.PutUint16(data[3:5], c.Decrement)
+	return ConfigFailedAuthCounter, data
+}
+
+// Implement DESFireConfiguration.
+func (c RawConfiguration) Configuration() (byte, []byte) {
+	return c.Option, c.Data
+}
+
+// Apply configuration option c to the PICC. This requires authentication
+// with the PICC master key. With a secure messaging session established by
+// AuthenticateEV2First() or AuthenticateLRPFirst(), all options are sent
+// natively. Otherwise, PICCConfiguration, DefaultKeyConfiguration, and
+// ATSConfiguration are applied through the libfreefare (see
+// SetConfiguration() and SetAts()) and the other options fail with an
+// AuthenticationError as they need a secure messaging session.
+func (t DESFireTag) Configure(c DESFireConfiguration) error {
+	if ats, ok := c.(ATSConfiguration); ok {
+		// TL counts itself, so an empty ATS or TL = 0 is invalid
+		if len(ats.ATS) < 1 || int(ats.ATS[0]) != len(ats.ATS) {
+			return Error(ParameterError)
+		}
+	}
+
+	if t.state != nil && t.state.ev2 != nil {
+		option, data := c.Configuration()
+		_, err := t.Command(cmdSetConfiguration, []byte{option}, data, Enciphered)
+		return err
+	}
+
+	switch c := c.(type) {
+	case PICCConfiguration:
+		return t.SetConfiguration(c.DisableFormat, c.RandomUID)
+	case DefaultKeyConfiguration:
+		return t.setDefaultKey(c)
+	case ATSConfiguration:
+		return t.SetAts(c.ATS)
+	default:
+		return Error(AuthenticationError)
+	}
+}
+
+// Apply a DefaultKeyConfiguration through the libfreefare. The libfreefare
+// takes a key object and sends its data and version, so build a key that
+// produces the desired bytes: an AES key for keys of up to 16 bytes, a
+// 3K3DES key (whose version is given by its parity bits) otherwise.
+func (t DESFireTag) setDefaultKey(c DefaultKeyConfiguration) error {
+	short := true
+	for _, b := range c.Key[16:] {
+		if b != 0 {
+			short = false
+		}
+	}
+
+	var key *DESFireKey
+	if short {
+		var value [16]byte
+		copy(value[:], c.Key[:16])
+		key = NewDESFireAESKey(value, c.Version)
+	} else {
+		key = NewDESFire3K3DESKey(c.Key)
+		if key.Version() != c.Version {
+			return Error(ParameterError)
+		}
+	}
+
+	r, err := C.mifare_desfire_set_default_key(t.ctag, key.key)
+	if r != 0 {
+		return t.TranslateError(err)
+	}
+
+	return nil
+}
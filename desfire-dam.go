@@ -0,0 +1,189 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "crypto/aes"
+import "crypto/cipher"
+import "encoding/binary"
+
+import "github.com/clausecker/freefare/internal/cmac"
+
+// Native command codes for delegated application management (DAM).
+const (
+	cmdCreateDelegatedApplication = 0xc9
+	cmdGetDelegatedInfo           = 0x69
+)
+
+// Numbers of the PICC level keys used for delegated application management.
+// The DAM authentication key authenticates the party creating a delegated
+// application, the DAM MAC and encryption keys are used by the card issuer
+// to authorize it, see NewDAMAuthorization().
+const (
+	DAMAuthKey = 0x10
+	DAMMACKey  = 0x11
+	DAMEncKey  = 0x12
+)
+
+// Bit of the second key settings byte requesting ISO file identifiers.
+const keySettingISOFileIDs = 0x20
+
+// Size of the default key field of EncK. Shorter keys are zero padded.
+const damKeySize = 24
+
+// A delegated application as created by CreateDelegatedApplication(). The
+// card issuer reserves memory for it in DAM slot SlotNo; the application
+// may use up to QuotaLimit blocks of 32 bytes. SlotVersion must be the
+// version the issuer assigned to the slot. If ISOFileID is not nil, the
+// application gets ISO file identifiers and the ISO DF name ISODFName (at
+// most 16 bytes, may be empty). Key sets are not supported.
+type DelegatedApplication struct {
+	AID         DESFireAid
+	SlotNo      uint16
+	SlotVersion byte
+	QuotaLimit  uint16
+	KeySettings DESFireKeySettings
+	ISOFileID   *uint16
+	ISODFName   []byte
+}
+
+// The authorization of a delegated application computed by the card issuer
+// with NewDAMAuthorization(): the encrypted default key of the application
+// (EncK) and the DAM MAC over the application parameters and EncK.
+type DAMAuthorization struct {
+	EncK [32]byte
+	MAC  [8]byte
+}
+
+// Information about a DAM slot as returned by GetDelegatedInfo(). AID is the
+// application occupying the slot, FreeBlocks the number of 32 byte blocks
+// of its quota not used yet.
+type DelegatedInfo struct {
+	SlotVersion byte
+	QuotaLimit  uint16
+	FreeBlocks  uint16
+	AID         DESFireAid
+}
+
+// Return the command header of CreateDelegatedApplication for a.
+func (a *DelegatedApplication) header() []byte {
+	ks2 := a.KeySettings.MarshalMaxKeys()
+	if a.ISOFileID != nil {
+		ks2 |= keySettingISOFileIDs
+	}
+
+	h := make([]byte, 0, 3+2+1+2+2+2+len(a.ISODFName))
+	h = append(h, a.AID[:]...)
+	h = append(h, byte(a.SlotNo), byte(a.SlotNo>>8), a.SlotVersion)
+	h = append(h, byte(a.QuotaLimit), byte(a.QuotaLimit>>8))
+	h = append(h, a.KeySettings.Marshal(), ks2)
+	if a.ISOFileID != nil {
+		h = append(h, byte(*a.ISOFileID), byte(*a.ISOFileID>>8))
+		h = append(h, a.ISODFName...)
+	}
+
+	return h
+}
+
+// Compute the authorization for creating the delegated application a on the
+// issuer side. encKey and macKey are the AES keys DAMEncKey and DAMMACKey of
+// the PICC. defaultKey is the key all keys of the new application are set
+// to and version its key version. Its length must match the cryptography
+// mode of a: 8 (DES) or 16 bytes (2K3DES) for CryptoDES, 24 bytes for
+// Crypto3k3DES, and 16 bytes for CryptoAES; a ParameterError is returned
+// otherwise. EncK is the encryption of 7 random bytes, the
+// default key zero padded to 24 bytes, and the key version under encKey; the
+// DAM MAC is the truncated CMAC under macKey over the command code, the
+// command header, and EncK. This function does not talk to a tag.
+func NewDAMAuthorization(a *DelegatedApplication, encKey, macKey [16]byte, defaultKey []byte, version byte) (DAMAuthorization, error) {
+	var auth DAMAuthorization
+	if !damKeySizeOK(a.KeySettings.Crypto, len(defaultKey)) || len(a.ISODFName) > 16 {
+		return auth, Error(ParameterError)
+	}
+
+	plain := make([]byte, 0, len(auth.EncK))
+	plain = append(plain, randomBytes(7)...)
+	plain = append(plain, defaultKey...)
+	plain = append(plain, make([]byte, damKeySize-len(defaultKey))...)
+	plain = append(plain, version)
+
+	// AES keys are always the right size, errors cannot happen
+	enc, _ := aes.NewCipher(encKey[:])
+	iv := make([]byte, aes.BlockSize)
+	cipher.NewCBCEncrypter(enc, iv).CryptBlocks(auth.EncK[:], plain)
+
+	msg := append([]byte{cmdCreateDelegatedApplication}, a.header()...)
+	msg = append(msg, auth.EncK[:]...)
+	mac, _ := aes.NewCipher(macKey[:])
+	copy(auth.MAC[:], cmac.Truncate(cmac.Sum(mac, msg)))
+
+	return auth, nil
+}
+
+// Report if n is a valid key size for keys of cryptography mode crypto.
+func damKeySizeOK(crypto byte, n int) bool {
+	switch crypto {
+	case CryptoDES:
+		return n == 8 || n == 16
+	case Crypto3k3DES:
+		return n == 24
+	case CryptoAES:
+		return n == 16
+	default:
+		return false
+	}
+}
+
+// Create the delegated application a with the authorization auth computed
+// by the card issuer. The PICC must be selected and an EV2 secure
+// messaging session authenticated with the DAM authentication key (see
+// DAMAuthKey) must be established with AuthenticateEV2First(). The keys of
+// the new application are set to the default key the issuer encrypted into
+// auth; change them right away.
+func (t DESFireTag) CreateDelegatedApplication(a *DelegatedApplication, auth DAMAuthorization) error {
+	if len(a.ISODFName) > 16 {
+		return Error(ParameterError)
+	}
+
+	header := a.header()
+	data := append(auth.EncK[:], auth.MAC[:]...)
+
+	// the tag wants EncK and the DAM MAC in an additional frame
+	_, err := t.command(cmdCreateDelegatedApplication, header, data, Maced, len(header))
+	return err
+}
+
+// Return information about DAM slot slotNo. This requires a secure messaging
+// session authenticated with the PICC master key or the DAM authentication
+// key.
+func (t DESFireTag) GetDelegatedInfo(slotNo uint16) (DelegatedInfo, error) {
+	resp, err := t.Command(cmdGetDelegatedInfo, []byte{byte(slotNo), byte(slotNo >> 8)}, nil, Maced)
+	if err != nil {
+		return DelegatedInfo{}, err
+	}
+
+	// DAMSlotVersion || QuotaLimit || FreeBlocks || AID
+	if len(resp) < 8 {
+		return DelegatedInfo{}, Error(LengthError)
+	}
+
+	info := DelegatedInfo{
+		SlotVersion: resp[0],
+		QuotaLimit:  binary.LittleEndian.Uint16(resp[1:3]),
+		FreeBlocks:  binary.LittleEndian.Uint16(resp[3:5]),
+	}
+	copy(info.AID[:], resp[5:8])
+
+	return info, nil
+}
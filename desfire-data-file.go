@@ -0,0 +1,163 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "io"
+
+// A standard or backup data file of a DESFire tag opened with OpenDataFile().
+// A DESFireDataFile implements io.ReaderAt, io.WriterAt, and io.ReadSeeker.
+// All accesses are bounded by the file size found when the file was opened.
+// Reads and writes use the ReadSettings and WriteSettings of the tag the file
+// was opened from. Writes to a backup data file take effect once the
+// transaction is committed with CommitTransaction().
+type DESFireDataFile struct {
+	t      DESFireTag
+	fileNo byte
+	size   int64
+	off    int64
+}
+
+// Open the standard or backup data file fileNo of the selected application.
+// The file size is taken from FileSettings().
+func (t DESFireTag) OpenDataFile(fileNo byte) (*DESFireDataFile, error) {
+	fs, err := t.FileSettings(fileNo)
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.FileType != StandardDataFile && fs.FileType != BackupDataFile {
+		return nil, Error(ParameterError)
+	}
+
+	return &DESFireDataFile{t: t, fileNo: fileNo, size: int64(fs.FileSize)}, nil
+}
+
+// Return the size of the file in bytes.
+func (f *DESFireDataFile) Size() int64 {
+	return f.size
+}
+
+// Read len(buf) bytes from the file at offset off. This function implements
+// io.ReaderAt and returns io.EOF if fewer than len(buf) bytes could be read
+// because the end of the file was reached.
+func (f *DESFireDataFile) ReadAt(buf []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, Error(ParameterError)
+	}
+
+	if off >= f.size {
+		return 0, io.EOF
+	}
+
+	var err error
+	if int64(len(buf)) > f.size-off {
+		buf = buf[:f.size-off]
+		err = io.EOF
+	}
+
+	n := 0
+	for n < len(buf) {
+		end := n + readChunkSize
+		if end > len(buf) {
+			end = len(buf)
+		}
+
+		r, rerr := f.t.ReadData(f.fileNo, off+int64(n), buf[n:end])
+		if rerr != nil {
+			return n, rerr
+		}
+
+		if r != end-n {
+			// short read, the tag returned less than asked
+			return n + r, Error(LengthError)
+		}
+
+		n = end
+	}
+
+	return n, err
+}
+
+// Write buf to the file at offset off. This function implements io.WriterAt.
+// Data past the end of the file is not written and a BoundaryError is
+// returned instead; DESFire data files cannot grow.
+func (f *DESFireDataFile) WriteAt(buf []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, Error(ParameterError)
+	}
+
+	var err error
+	if off > f.size {
+		return 0, Error(BoundaryError)
+	} else if int64(len(buf)) > f.size-off {
+		buf = buf[:f.size-off]
+		err = Error(BoundaryError)
+	}
+
+	n := 0
+	for n < len(buf) {
+		end := n + readChunkSize
+		if end > len(buf) {
+			end = len(buf)
+		}
+
+		w, werr := f.t.WriteData(f.fileNo, off+int64(n), buf[n:end])
+		if werr != nil {
+			return n, werr
+		}
+
+		if w != end-n {
+			return n + w, Error(LengthError)
+		}
+
+		n = end
+	}
+
+	return n, err
+}
+
+// Read from the file at the current offset and advance the offset by the
+// number of bytes read. This function implements io.Reader.
+func (f *DESFireDataFile) Read(buf []byte) (int, error) {
+	n, err := f.ReadAt(buf, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+
+	return n, err
+}
+
+// Set the offset for the next call to Read(). This function implements
+// io.Seeker. Seeking past the end of the file is permitted, subsequent reads
+// return io.EOF.
+func (f *DESFireDataFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return f.off, Error(ParameterError)
+	}
+
+	if offset < 0 {
+		return f.off, Error(ParameterError)
+	}
+
+	f.off = offset
+	return offset, nil
+}
@@ -14,6 +14,7 @@
 
 package freefare
 
+// #include <stdlib.h>
 // #include <freefare.h>
 import "C"
 import "unsafe"
@@ -24,13 +25,14 @@ import "unsafe"
 // file, this function is a nop if len(buf) == 0. Try passing a large enough
 // buffer instead.
 //
-// This function wraps either mifare_desfire_read_data() or
-// mifare_desfire_read_data_ex(), depending on the value of t.ReadSettings.
+// The libfreefare writes the raw response including MAC or CRC and padding
+// into the buffer it is given. To prevent memory corruption, this function
+// reads into a scratch buffer large enough for this overhead and copies only
+// the requested bytes to buf.
+//
+// This function wraps mifare_desfire_read_data_ex(). The communication mode is
+// t.ReadSettings or, if that is Default, the mode of the file (see DESFireTag).
 func (t DESFireTag) ReadData(fileNo byte, offset int64, buf []byte) (int, error) {
-	// BUG(libfreefare) The libfreefare <= 0.4.0 may use more bytes of buf
-	// than available; memory corruption may happen. I have yet to figure
-	// out how to mitigate this issue.
-
 	// sanity checks first. This function uses an int64 for offset to be
 	// similar to the io.ReaderAt interface
 	if offset < 0 {
@@ -41,31 +43,75 @@ func (t DESFireTag) ReadData(fileNo byte, offset int64, buf []byte) (int, error)
 		return 0, nil
 	}
 
-	var r C.ssize_t
-	var err error
-	if t.ReadSettings == Default {
-		r, err = C.mifare_desfire_read_data(
-			t.ctag, C.uint8_t(fileNo), C.off_t(offset),
-			C.size_t(len(buf)), unsafe.Pointer(&buf[0]))
-	} else {
-		r, err = C.mifare_desfire_read_data_ex(
-			t.ctag, C.uint8_t(fileNo), C.off_t(offset),
-			C.size_t(len(buf)), unsafe.Pointer(&buf[0]),
-			C.int(t.WriteSettings))
+	mode, err := t.readMode(fileNo)
+	if err != nil {
+		return -1, err
 	}
 
+	scratch := newReadBuffer(len(buf))
+	defer scratch.free()
+
+	r, err := C.mifare_desfire_read_data_ex(
+		t.ctag, C.uint8_t(fileNo), C.off_t(offset),
+		C.size_t(len(buf)), scratch.ptr,
+		C.int(mode))
+
 	if r < 0 {
 		return int(r), t.TranslateError(err)
 	}
 
-	return int(r), nil
+	return scratch.copyTo(buf, int(r)), nil
+}
+
+// Number of bytes the libfreefare may write to the buffer passed to
+// mifare_desfire_read_data() and mifare_desfire_read_records() in excess of
+// the data requested: the status byte it appends, plus the MAC (EV1 sessions
+// with CMAC append one even in Plain mode) or the CRC and the padding to the
+// cipher block size. What the libfreefare does depends on the communication
+// mode of the file rather than the mode requested, so always allow for the
+// worst case.
+const readOverhead = 1 + 4 + 16 - 1 // status, CRC32, padding to AES blocks
+
+// A scratch buffer allocated with C.malloc for the libfreefare to read into.
+type readBuffer struct {
+	ptr unsafe.Pointer
+	len int
+}
+
+// Allocate a scratch buffer to read n bytes of data.
+func newReadBuffer(n int) readBuffer {
+	size := n + readOverhead
+	ptr := C.malloc(C.size_t(size))
+	if ptr == nil {
+		panic("C.malloc() returned nil (out of memory)")
+	}
+
+	return readBuffer{ptr, size}
+}
+
+// Copy the first n bytes read into buf, but no more than len(buf) bytes.
+// Return the number of bytes copied.
+func (b readBuffer) copyTo(buf []byte, n int) int {
+	if n > b.len {
+		// the libfreefare claims to have read more than we asked it
+		// to; better not trust it.
+		n = b.len
+	}
+
+	return copy(buf, unsafe.Slice((*byte)(b.ptr), n))
+}
+
+// Release the scratch buffer.
+func (b readBuffer) free() {
+	C.free(b.ptr)
 }
 
 // Write bytes to data file fileNo at offset offset. This function returns the
 // number of bytes written or an error.
 //
-// This function wraps either mifare_desfire_write_data() or
-// mifare_desfire_write_data_ex(), depending on the value of t.WriteSettings.
+// This function wraps mifare_desfire_write_data_ex(). The communication mode is
+// t.WriteSettings or, if that is Default, the mode of the file (see
+// DESFireTag).
 func (t DESFireTag) WriteData(fileNo byte, offset int64, buf []byte) (int, error) {
 	// sanity checks first. This function uses an int64 for offset to be
 	// similar to the io.ReaderAt interface
@@ -73,19 +119,18 @@ func (t DESFireTag) WriteData(fileNo byte, offset int64, buf []byte) (int, error
 		return -1, Error(ParameterError)
 	}
 
-	var r C.ssize_t
-	var err error
-	if t.WriteSettings == Default {
-		r, err = C.mifare_desfire_write_data(
-			t.ctag, C.uint8_t(fileNo), C.off_t(offset),
-			C.size_t(len(buf)), unsafe.Pointer(&buf[0]))
-	} else {
-		r, err = C.mifare_desfire_write_data_ex(
-			t.ctag, C.uint8_t(fileNo), C.off_t(offset),
-			C.size_t(len(buf)), unsafe.Pointer(&buf[0]),
-			C.int(t.WriteSettings))
+	t.touch(fileNo)
+
+	mode, err := t.writeMode(fileNo)
+	if err != nil {
+		return -1, err
 	}
 
+	r, err := C.mifare_desfire_write_data_ex(
+		t.ctag, C.uint8_t(fileNo), C.off_t(offset),
+		C.size_t(len(buf)), unsafe.Pointer(&buf[0]),
+		C.int(mode))
+
 	if r < 0 {
 		return int(r), t.TranslateError(err)
 	}
@@ -95,20 +140,18 @@ func (t DESFireTag) WriteData(fileNo byte, offset int64, buf []byte) (int, error
 
 // Read the value of value file fileNo.
 //
-// This function wraps either mifare_desfire_get_value() or
-// mifare_desfire_get_value_ex(), depending on the value of t.ReadSettings.
+// This function wraps mifare_desfire_get_value_ex(). The communication mode is
+// t.ReadSettings or, if that is Default, the mode of the file (see DESFireTag).
 func (t DESFireTag) Value(fileNo byte) (int32, error) {
-	var r C.int
-	var err error
 	var val C.int32_t
-	if t.ReadSettings == Default {
-		r, err = C.mifare_desfire_get_value(
-			t.ctag, C.uint8_t(fileNo), &val)
-	} else {
-		r, err = C.mifare_desfire_get_value_ex(
-			t.ctag, C.uint8_t(fileNo), &val, C.int(t.ReadSettings))
+	mode, err := t.readMode(fileNo)
+	if err != nil {
+		return -1, err
 	}
 
+	r, err := C.mifare_desfire_get_value_ex(
+		t.ctag, C.uint8_t(fileNo), &val, C.int(mode))
+
 	if r != 0 {
 		return -1, t.TranslateError(err)
 	}
@@ -118,20 +161,21 @@ func (t DESFireTag) Value(fileNo byte) (int32, error) {
 
 // Add amount to the value of the file fileNo.
 //
-// This function wraps either mifare_desfire_credit() or
-// mifare_desfire_credit_ex(), depending on the value of t.WriteSettings.
+// This function wraps mifare_desfire_credit_ex(). The communication mode is
+// t.WriteSettings or, if that is Default, the mode of the file (see
+// DESFireTag).
 func (t DESFireTag) Credit(fileNo byte, amount int32) error {
-	var r C.int
-	var err error
-	if t.WriteSettings == Default {
-		r, err = C.mifare_desfire_credit(
-			t.ctag, C.uint8_t(fileNo), C.int32_t(amount))
-	} else {
-		r, err = C.mifare_desfire_credit_ex(
-			t.ctag, C.uint8_t(fileNo), C.int32_t(amount),
-			C.int(t.WriteSettings))
+	t.touch(fileNo)
+
+	mode, err := t.writeMode(fileNo)
+	if err != nil {
+		return err
 	}
 
+	r, err := C.mifare_desfire_credit_ex(
+		t.ctag, C.uint8_t(fileNo), C.int32_t(amount),
+		C.int(mode))
+
 	if r != 0 {
 		return t.TranslateError(err)
 	}
@@ -141,20 +185,21 @@ func (t DESFireTag) Credit(fileNo byte, amount int32) error {
 
 // Subtract amount from the value of the file fileNo.
 //
-// This function wraps either mifare_desfire_debit() or
-// mifare_desfire_debit_ex(), depending on the value of t.WriteSettings.
+// This function wraps mifare_desfire_debit_ex(). The communication mode is
+// t.WriteSettings or, if that is Default, the mode of the file (see
+// DESFireTag).
 func (t DESFireTag) Debit(fileNo byte, amount int32) error {
-	var r C.int
-	var err error
-	if t.WriteSettings == Default {
-		r, err = C.mifare_desfire_debit(
-			t.ctag, C.uint8_t(fileNo), C.int32_t(amount))
-	} else {
-		r, err = C.mifare_desfire_debit_ex(
-			t.ctag, C.uint8_t(fileNo), C.int32_t(amount),
-			C.int(t.WriteSettings))
+	t.touch(fileNo)
+
+	mode, err := t.writeMode(fileNo)
+	if err != nil {
+		return err
 	}
 
+	r, err := C.mifare_desfire_debit_ex(
+		t.ctag, C.uint8_t(fileNo), C.int32_t(amount),
+		C.int(mode))
+
 	if r != 0 {
 		return t.TranslateError(err)
 	}
@@ -164,20 +209,21 @@ func (t DESFireTag) Debit(fileNo byte, amount int32) error {
 
 // Add amount to the value of the file fileNo.
 //
-// This function wraps either mifare_desfire_credit() or
-// mifare_desfire_credit_ex(), depending on the value of t.WriteSettings.
+// This function wraps mifare_desfire_limited_credit_ex(). The communication mode is
+// t.WriteSettings or, if that is Default, the mode of the file (see
+// DESFireTag).
 func (t DESFireTag) LimitedCredit(fileNo byte, amount int32) error {
-	var r C.int
-	var err error
-	if t.WriteSettings == Default {
-		r, err = C.mifare_desfire_limited_credit(
-			t.ctag, C.uint8_t(fileNo), C.int32_t(amount))
-	} else {
-		r, err = C.mifare_desfire_limited_credit_ex(
-			t.ctag, C.uint8_t(fileNo), C.int32_t(amount),
-			C.int(t.WriteSettings))
+	t.touch(fileNo)
+
+	mode, err := t.writeMode(fileNo)
+	if err != nil {
+		return err
 	}
 
+	r, err := C.mifare_desfire_limited_credit_ex(
+		t.ctag, C.uint8_t(fileNo), C.int32_t(amount),
+		C.int(mode))
+
 	if r != 0 {
 		return t.TranslateError(err)
 	}
@@ -188,8 +234,9 @@ func (t DESFireTag) LimitedCredit(fileNo byte, amount int32) error {
 // Write len(data) records starting at record from data to the record file
 // fileNo and return the number of bytes written or an error.
 //
-// This function wraps either mifare_desfire_write_record() or
-// mifare_desfire_write_record_ex(), depending on the value of t.WriteSettings.
+// This function wraps mifare_desfire_write_record_ex(). The communication mode
+// is t.WriteSettings or, if that is Default, the mode of the file (see
+// DESFireTag).
 func (t DESFireTag) WriteRecord(fileNo byte, offset int64, buf []byte) (int, error) {
 	// sanity checks first. This function uses an int64 for offset to be
 	// similar to the io.ReaderAt interface
@@ -197,19 +244,18 @@ func (t DESFireTag) WriteRecord(fileNo byte, offset int64, buf []byte) (int, err
 		return -1, Error(ParameterError)
 	}
 
-	var r C.ssize_t
-	var err error
-	if t.WriteSettings == Default {
-		r, err = C.mifare_desfire_write_record(
-			t.ctag, C.uint8_t(fileNo), C.off_t(offset),
-			C.size_t(len(buf)), unsafe.Pointer(&buf[0]))
-	} else {
-		r, err = C.mifare_desfire_write_record_ex(
-			t.ctag, C.uint8_t(fileNo), C.off_t(offset),
-			C.size_t(len(buf)), unsafe.Pointer(&buf[0]),
-			C.int(t.WriteSettings))
+	t.touch(fileNo)
+
+	mode, err := t.writeMode(fileNo)
+	if err != nil {
+		return -1, err
 	}
 
+	r, err := C.mifare_desfire_write_record_ex(
+		t.ctag, C.uint8_t(fileNo), C.off_t(offset),
+		C.size_t(len(buf)), unsafe.Pointer(&buf[0]),
+		C.int(mode))
+
 	if r < 0 {
 		return int(r), t.TranslateError(err)
 	}
@@ -217,16 +263,23 @@ func (t DESFireTag) WriteRecord(fileNo byte, offset int64, buf []byte) (int, err
 	return int(r), nil
 }
 
-// Read len(data) records starting at record offset from the record file fileNo
-// and copy them to data, returning the number of bytes read or an error.
+// Read records starting at record offset from the record file fileNo and copy
+// them to buf, returning the number of bytes copied or an error. Record 0 is
+// the most recent record. As many records as are needed to fill buf are read;
+// if len(buf) is not a multiple of the record size, the data of the last
+// record is truncated. This function is a nop if len(buf) == 0.
+//
+// Previous versions of this wrapper requested len(buf) records which lead to
+// memory corruption for records longer than one byte. As the record size is
+// needed to compute the number of records, this function calls FileSettings()
+// unless the file settings are already cached. Like ReadData(), this function
+// reads into a scratch buffer large enough for the overhead the libfreefare
+// writes and copies only the requested bytes to buf.
 //
-// This function wraps either mifare_desfire_read_records() or
-// mifare_desfire_read_records_ex(), depending on the value of t.ReadSettings.
+// This function wraps mifare_desfire_read_records_ex(). The communication mode
+// is t.ReadSettings or, if that is Default, the mode of the file (see
+// DESFireTag).
 func (t DESFireTag) ReadRecords(fileNo byte, offset int64, buf []byte) (int, error) {
-	// BUG(libfreefare) The libfreefare <= 0.4.0 may use more bytes of buf
-	// than available; memory corruption may happen. I have yet to figure
-	// out how to mitigate this issue.
-
 	// sanity checks first. This function uses an int64 for offset to be
 	// similar to the io.ReaderAt interface
 	if offset < 0 {
@@ -237,28 +290,55 @@ func (t DESFireTag) ReadRecords(fileNo byte, offset int64, buf []byte) (int, err
 		return 0, nil
 	}
 
-	var r C.ssize_t
-	var err error
-	if t.ReadSettings == Default {
-		r, err = C.mifare_desfire_read_records(
-			t.ctag, C.uint8_t(fileNo), C.off_t(offset),
-			C.size_t(len(buf)), unsafe.Pointer(&buf[0]))
-	} else {
-		r, err = C.mifare_desfire_read_records_ex(
-			t.ctag, C.uint8_t(fileNo), C.off_t(offset),
-			C.size_t(len(buf)), unsafe.Pointer(&buf[0]),
-			C.int(t.WriteSettings))
+	fm, err := t.fileModes(fileNo)
+	if err != nil {
+		return -1, err
+	}
+
+	recordSize := fm.recordSize
+	if recordSize == 0 {
+		// not a record file
+		return -1, Error(ParameterError)
+	}
+
+	records := (len(buf) + recordSize - 1) / recordSize
+	return t.readRecords(fileNo, offset, records, recordSize, buf)
+}
+
+// Read records records of size recordSize starting at record offset from the
+// record file fileNo and copy them to buf. This is the part of ReadRecords()
+// after the record size has been found.
+func (t DESFireTag) readRecords(
+	fileNo byte,
+	offset int64,
+	records int,
+	recordSize int,
+	buf []byte,
+) (int, error) {
+	mode, err := t.readMode(fileNo)
+	if err != nil {
+		return -1, err
 	}
 
+	scratch := newReadBuffer(records * recordSize)
+	defer scratch.free()
+
+	r, err := C.mifare_desfire_read_records_ex(
+		t.ctag, C.uint8_t(fileNo), C.off_t(offset),
+		C.size_t(records), scratch.ptr,
+		C.int(mode))
+
 	if r < 0 {
 		return int(r), t.TranslateError(err)
 	}
 
-	return int(r), nil
+	return scratch.copyTo(buf, int(r)), nil
 }
 
 // Erase all records from the record file fileNo
 func (t DESFireTag) ClearRecordFile(fileNo byte) error {
+	t.touch(fileNo)
+
 	r, err := C.mifare_desfire_clear_record_file(t.ctag, C.uint8_t(fileNo))
 	if r != 0 {
 		return t.TranslateError(err)
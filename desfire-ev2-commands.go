@@ -0,0 +1,230 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "encoding/binary"
+import "hash/crc32"
+
+// Native command codes of the DESFire EV2 command set as used by NTAG 424
+// DNA and DESFire Light tags.
+const (
+	cmdReadDataEV2        = 0xad
+	cmdWriteDataEV2       = 0x8d
+	cmdChangeKeyEV2       = 0xc4
+	cmdGetKeyVersion      = 0x64
+	cmdGetCardUID         = 0x51
+	cmdSetConfiguration   = 0x5c
+	cmdGetFileCounters    = 0xf6
+	cmdGetFileSettings    = 0xf5
+	cmdChangeFileSettings = 0x5f
+	cmdGetFileIDs         = 0x6f
+	cmdGetISOFileIDs      = 0x61
+	cmdReadSig            = 0x3c
+)
+
+// ISO 7816-4 SELECT FILE parameters.
+const (
+	isoSelectFile       = 0xa4
+	isoSelectByDFName   = 0x04
+	isoSelectNoResponse = 0x0c
+)
+
+// Commands common to the tags with a fixed application and the DESFire EV2
+// command set: NTAG 424 DNA and DESFire Light. All commands are implemented
+// natively and need a secure messaging session established with
+// AuthenticateEV2First() or AuthenticateLRPFirst() unless noted otherwise.
+type ev2Tag struct {
+	DESFireTag
+}
+
+// Select an application by its ISO DF name. Selecting drops the secure
+// messaging session.
+func (t ev2Tag) selectDFName(name []byte) error {
+	t.dropSession()
+	t.unselected()
+	t.forgetFiles()
+	_, err := t.isoCommand(0x00, isoSelectFile, isoSelectByDFName,
+		isoSelectNoResponse, name, 0)
+	return err
+}
+
+// Return Maced if there is a secure messaging session and Plain otherwise.
+// This is the communication mode of commands that can be used both with and
+// without authentication.
+func (t ev2Tag) macedIfAuthenticated() byte {
+	if t.state != nil && t.state.ev2 != nil {
+		return Maced
+	}
+
+	return Plain
+}
+
+// Encode a 24 bit little endian integer as used for offsets and lengths.
+func uint24(n uint32) []byte {
+	return []byte{byte(n), byte(n >> 8), byte(n >> 16)}
+}
+
+// Read length bytes from file fileNo at offset offset using communication mode
+// commMode, which must match the communication mode of the file. If length is
+// 0, the whole file from offset on is read.
+func (t ev2Tag) ReadData(fileNo byte, offset, length uint32, commMode byte) ([]byte, error) {
+	header := append([]byte{fileNo}, uint24(offset)...)
+	header = append(header, uint24(length)...)
+	return t.Command(cmdReadDataEV2, header, nil, commMode)
+}
+
+// Write data to file fileNo at offset offset using communication mode
+// commMode, which must match the communication mode of the file.
+func (t ev2Tag) WriteData(fileNo byte, offset uint32, data []byte, commMode byte) error {
+	header := append([]byte{fileNo}, uint24(offset)...)
+	header = append(header, uint24(uint32(len(data)))...)
+	_, err := t.Command(cmdWriteDataEV2, header, data, commMode)
+	return err
+}
+
+// Change the AES key keyNo from oldKey to newKey using the EV2 ChangeKey
+// command with the given command header. If there is no secure messaging
+// session, a TagStateError is returned.
+func (t DESFireTag) changeKeyEV2(header []byte, keyNo byte, newKey, oldKey [16]byte, version byte) error {
+	if t.state == nil || t.state.ev2 == nil {
+		return Error(TagStateError)
+	}
+
+	s := t.state.ev2
+	var data []byte
+	if keyNo == s.keyNo {
+		data = append(newKey[:], version)
+	} else {
+		data = make([]byte, 16, 21)
+		for i := range data {
+			data[i] = newKey[i] ^ oldKey[i]
+		}
+
+		// CRC32 without the final complement, as used by DESFire
+		var crc [4]byte
+		binary.LittleEndian.PutUint32(crc[:], ^crc32.ChecksumIEEE(newKey[:]))
+		data = append(data, version)
+		data = append(data, crc[:]...)
+	}
+
+	if keyNo != s.keyNo {
+		_, err := t.Command(cmdChangeKeyEV2, header, data, Enciphered)
+		return err
+	}
+
+	// Changing the authenticated key ends the session, the response
+	// carries no MAC.
+	_, err := t.exchange(cmdChangeKeyEV2, s.wrap(cmdChangeKeyEV2, header, data, Enciphered))
+	t.dropSession()
+	return err
+}
+
+// Change the key keyNo from oldKey to newKey and set its version to version.
+// This requires a secure messaging session authenticated with the key allowed
+// to change keys (usually key 0). When changing the key used for
+// authentication, oldKey is ignored and the session ends. If there is no
+// secure messaging session, a TagStateError is returned.
+func (t ev2Tag) ChangeKey(keyNo byte, newKey, oldKey [16]byte, version byte) error {
+	return t.changeKeyEV2([]byte{keyNo}, keyNo, newKey, oldKey, version)
+}
+
+// Retrieve the version of key keyNo. This works with and without
+// authentication.
+func (t ev2Tag) KeyVersion(keyNo byte) (byte, error) {
+	resp, err := t.Command(cmdGetKeyVersion, []byte{keyNo}, nil, t.macedIfAuthenticated())
+	if err != nil {
+		return 0, err
+	}
+
+	if len(resp) < 1 {
+		return 0, Error(LengthError)
+	}
+
+	return resp[0], nil
+}
+
+// Retrieve the 7 byte UID of the tag. This is needed if random ID is enabled.
+func (t ev2Tag) CardUID() ([]byte, error) {
+	return t.Command(cmdGetCardUID, nil, nil, Enciphered)
+}
+
+// Retrieve the SDM read counter of file fileNo.
+func (t ev2Tag) FileCounters(fileNo byte) (uint32, error) {
+	resp, err := t.Command(cmdGetFileCounters, []byte{fileNo}, nil, Enciphered)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(resp) < 3 {
+		return 0, Error(LengthError)
+	}
+
+	return getUint24(resp), nil
+}
+
+// Retrieve the settings of file fileNo. This works with and without
+// authentication.
+func (t ev2Tag) FileSettings(fileNo byte) (DESFireEV2FileSettings, error) {
+	resp, err := t.Command(cmdGetFileSettings, []byte{fileNo}, nil, t.macedIfAuthenticated())
+	if err != nil {
+		return DESFireEV2FileSettings{DESFireFileSettings: DESFireFileSettings{FileType: 0xff}}, err
+	}
+
+	return decodeEV2FileSettings(resp)
+}
+
+// Change the communication settings, access rights, and SDM settings of file
+// fileNo. Pass a nil sdm to disable secure dynamic messaging. This requires
+// authentication with the key given by the change access right of the file.
+func (t ev2Tag) ChangeFileSettings(fileNo, communicationSettings byte, accessRights DESFireAccessRights, sdm *SDMSettings) error {
+	t.forgetFile(fileNo)
+	data := encodeEV2FileSettings(communicationSettings, accessRights, sdm)
+	_, err := t.Command(cmdChangeFileSettings, []byte{fileNo}, data, Enciphered)
+	return err
+}
+
+// Return the list of file numbers. This works with and without
+// authentication.
+func (t ev2Tag) FileIds() ([]byte, error) {
+	return t.Command(cmdGetFileIDs, nil, nil, t.macedIfAuthenticated())
+}
+
+// Return the list of ISO file identifiers. This works with and without
+// authentication.
+func (t ev2Tag) IsoFileIds() ([]uint16, error) {
+	resp, err := t.Command(cmdGetISOFileIDs, nil, nil, t.macedIfAuthenticated())
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint16, len(resp)/2)
+	for i := range ids {
+		ids[i] = binary.LittleEndian.Uint16(resp[2*i:])
+	}
+
+	return ids, nil
+}
+
+// Read the 56 byte originality signature over the UID. The signature is
+// verified with NXP's public key for the product, which this wrapper does
+// not provide. This works with and without authentication.
+func (t ev2Tag) Signature() ([]byte, error) {
+	mode := byte(Plain)
+	if t.state != nil && t.state.ev2 != nil {
+		mode = Enciphered
+	}
+
+	return t.Command(cmdReadSig, []byte{0x00}, nil, mode)
+}
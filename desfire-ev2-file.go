@@ -0,0 +1,253 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "encoding/binary"
+
+// Additional file type of EV2 style tags (DESFire EV2, Light, NTAG 424) as
+// used in DESFireEV2FileSettings.
+const TransactionMACFile = 5
+
+// Bits of the FileOption byte in EV2 file settings.
+const (
+	fileOptionCommMode = 0x03
+	fileOptionSDM      = 0x40
+)
+
+// Bits of the SDMOptions byte.
+const (
+	sdmOptionUID          = 0x80
+	sdmOptionReadCtr      = 0x40
+	sdmOptionReadCtrLimit = 0x20
+	sdmOptionENCFileData  = 0x10
+	sdmOptionASCII        = 0x01
+)
+
+// Secure dynamic messaging (SDM) settings of a file on an EV2 style tag.
+// Which offsets are meaningful depends on the options and access rights as
+// described in the NTAG 424 DNA data sheet: UIDOffset and ReadCtrOffset are
+// used if MetaRead is Free, PICCDataOffset if MetaRead is a key number,
+// MACInputOffset and MACOffset if FileRead is not Deny, ENCOffset and
+// ENCLength if additionally ENCFileData is set, and ReadCtrLimit if
+// ReadCtrLimitEnabled is set. Use the package github.com/clausecker/freefare/sdm
+// to verify the resulting messages.
+type SDMSettings struct {
+	UIDMirror           bool // mirror the UID
+	ReadCtrMirror       bool // mirror the SDM read counter
+	ReadCtrLimitEnabled bool // limit the number of reads
+	ENCFileData         bool // mirror encrypted file data
+	ASCII               bool // mirror in ASCII hex (the only mode defined)
+
+	// access rights: key numbers, Free, or Deny
+	CtrRet, MetaRead, FileRead byte
+
+	UIDOffset, ReadCtrOffset, PICCDataOffset uint32
+	MACInputOffset, MACOffset                uint32
+	ENCOffset, ENCLength                     uint32
+	ReadCtrLimit                             uint32
+}
+
+// File settings of a file on an EV2 style tag. This extends the EV1 file
+// settings with secure dynamic messaging and transaction MAC files.
+type DESFireEV2FileSettings struct {
+	DESFireFileSettings
+
+	// SDM settings, nil if SDM is disabled for this file
+	SDM *SDMSettings
+
+	// FileType == TransactionMACFile
+	TMKeyOption, TMKeyVersion byte
+}
+
+// Read a 24 bit little endian integer.
+func getUint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+// Decode the response of GetFileSettings on an EV2 style tag.
+func decodeEV2FileSettings(b []byte) (DESFireEV2FileSettings, error) {
+	// explicitly invalid FileType as returned by FileSettings()
+	invalid := DESFireEV2FileSettings{DESFireFileSettings: DESFireFileSettings{FileType: 0xff}}
+	if len(b) < 4 {
+		return invalid, Error(LengthError)
+	}
+
+	fs := DESFireEV2FileSettings{}
+
+	fs.FileType = b[0]
+	fs.CommunicationSettings = b[1] & fileOptionCommMode
+	fs.AccessRights.Unmarshal(binary.LittleEndian.Uint16(b[2:4]))
+	sdm := b[1]&fileOptionSDM != 0
+	b = b[4:]
+
+	var need int
+	switch fs.FileType {
+	case StandardDataFile, BackupDataFile:
+		need = 3
+	case ValueFileWithBackup:
+		need = 13
+	case LinearRecordFileWithBackup, CyclicRecordFileWithBackup:
+		need = 9
+	case TransactionMACFile:
+		need = 2
+	default:
+		return invalid, Error(ParameterError)
+	}
+
+	if len(b) < need {
+		return invalid, Error(LengthError)
+	}
+
+	switch fs.FileType {
+	case StandardDataFile, BackupDataFile:
+		fs.FileSize = getUint24(b)
+	case ValueFileWithBackup:
+		fs.LowerLimit = int32(binary.LittleEndian.Uint32(b[0:4]))
+		fs.UpperLimit = int32(binary.LittleEndian.Uint32(b[4:8]))
+		fs.LimitedCreditValue = int32(binary.LittleEndian.Uint32(b[8:12]))
+		fs.LimitedCreditEnabled = b[12]
+	case LinearRecordFileWithBackup, CyclicRecordFileWithBackup:
+		fs.RecordSize = getUint24(b[0:3])
+		fs.MaxNumberOfRecords = getUint24(b[3:6])
+		fs.CurrentNumberOfRecords = getUint24(b[6:9])
+	case TransactionMACFile:
+		fs.TMKeyOption = b[0]
+		fs.TMKeyVersion = b[1]
+	}
+
+	b = b[need:]
+	if !sdm {
+		return fs, nil
+	}
+
+	s, err := decodeSDMSettings(b)
+	if err != nil {
+		return invalid, err
+	}
+
+	fs.SDM = &s
+	return fs, nil
+}
+
+// Decode SDM settings following the type specific file settings.
+func decodeSDMSettings(b []byte) (SDMSettings, error) {
+	var s SDMSettings
+	if len(b) < 3 {
+		return s, Error(LengthError)
+	}
+
+	opt := b[0]
+	s.UIDMirror = opt&sdmOptionUID != 0
+	s.ReadCtrMirror = opt&sdmOptionReadCtr != 0
+	s.ReadCtrLimitEnabled = opt&sdmOptionReadCtrLimit != 0
+	s.ENCFileData = opt&sdmOptionENCFileData != 0
+	s.ASCII = opt&sdmOptionASCII != 0
+	s.MetaRead = b[1] >> 4
+	s.FileRead = b[1] & 0xf
+	s.CtrRet = b[2] & 0xf
+	b = b[3:]
+
+	for _, p := range s.offsets() {
+		if len(b) < 3 {
+			return SDMSettings{}, Error(LengthError)
+		}
+
+		*p = getUint24(b)
+		b = b[3:]
+	}
+
+	return s, nil
+}
+
+// Return pointers to the offsets present in the encoded form of s, in order.
+func (s *SDMSettings) offsets() []*uint32 {
+	var o []*uint32
+	switch s.MetaRead {
+	case Free:
+		if s.UIDMirror {
+			o = append(o, &s.UIDOffset)
+		}
+
+		if s.ReadCtrMirror {
+			o = append(o, &s.ReadCtrOffset)
+		}
+	case Deny:
+	default:
+		o = append(o, &s.PICCDataOffset)
+	}
+
+	if s.FileRead != Deny {
+		o = append(o, &s.MACInputOffset)
+		if s.ENCFileData {
+			o = append(o, &s.ENCOffset, &s.ENCLength)
+		}
+
+		o = append(o, &s.MACOffset)
+	}
+
+	if s.ReadCtrLimitEnabled {
+		o = append(o, &s.ReadCtrLimit)
+	}
+
+	return o
+}
+
+// Encode SDM settings as used in ChangeFileSettings.
+func (s *SDMSettings) encode() []byte {
+	var opt byte
+	if s.UIDMirror {
+		opt |= sdmOptionUID
+	}
+
+	if s.ReadCtrMirror {
+		opt |= sdmOptionReadCtr
+	}
+
+	if s.ReadCtrLimitEnabled {
+		opt |= sdmOptionReadCtrLimit
+	}
+
+	if s.ENCFileData {
+		opt |= sdmOptionENCFileData
+	}
+
+	if s.ASCII {
+		opt |= sdmOptionASCII
+	}
+
+	b := []byte{opt, s.MetaRead<<4 | s.FileRead&0xf, 0xf0 | s.CtrRet&0xf}
+	for _, p := range s.offsets() {
+		b = append(b, uint24(*p)...)
+	}
+
+	return b
+}
+
+// Encode the data of a ChangeFileSettings command: FileOption, AccessRights
+// and, if enabled, the SDM settings.
+func encodeEV2FileSettings(communicationSettings byte, accessRights DESFireAccessRights, sdm *SDMSettings) []byte {
+	opt := communicationSettings & fileOptionCommMode
+	if sdm != nil {
+		opt |= fileOptionSDM
+	}
+
+	ar := accessRights.Marshal()
+	b := []byte{opt, byte(ar), byte(ar >> 8)}
+	if sdm != nil {
+		b = append(b, sdm.encode()...)
+	}
+
+	return b
+}
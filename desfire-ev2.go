@@ -0,0 +1,356 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "bytes"
+import "crypto/aes"
+import "crypto/cipher"
+import "crypto/rand"
+import "crypto/subtle"
+import "encoding/binary"
+
+import "github.com/clausecker/freefare/internal/cmac"
+import "github.com/clausecker/freefare/sm"
+
+// Native command codes used for EV2 style authentication.
+const (
+	cmdAuthenticateEV2First    = 0x71
+	cmdAuthenticateEV2NonFirst = 0x77
+)
+
+// A secure messaging session established by AuthenticateEV2First() or
+// AuthenticateLRPFirst(). The session is kept in the desfireState and
+// shared by all copies of a DESFireTag.
+type ev2Session struct {
+	keyNo      byte
+	ti         [4]byte // transaction identifier
+	cmdCtr     uint16  // command counter
+	suite      smSuite
+	rndA, rndB []byte // random numbers of the last authentication
+}
+
+// The cryptographic primitives of a secure messaging flavour: AES for EV2
+// secure messaging, LRP for LRP secure messaging. The framing is the same
+// for both.
+type smSuite interface {
+	// Compute the untruncated MAC of msg.
+	mac(msg []byte) []byte
+
+	// Encrypt command data or decrypt response data. data is padded
+	// already and a multiple of 16 bytes long. ctr is the command counter
+	// to use, i.e. s.cmdCtr for commands and s.cmdCtr+1 for responses.
+	encrypt(ti []byte, ctr uint16, data []byte) []byte
+	decrypt(ti []byte, ctr uint16, data []byte) []byte
+
+	// Return the protocol (sm.EV2 or sm.LRP) and the key material
+	// needed to verify response MACs offline, see sm.Response.
+	evidence() (protocol int, macKey []byte)
+}
+
+// EV2 secure messaging with AES session keys. macRaw is the MAC key as a
+// byte slice.
+type aesSuite struct {
+	encKey, macKey cipher.Block
+	macRaw         []byte
+}
+
+func (a aesSuite) mac(msg []byte) []byte {
+	return cmac.Sum(a.macKey, msg)
+}
+
+func (a aesSuite) evidence() (int, []byte) {
+	return sm.EV2, a.macRaw
+}
+
+// Compute the IV for EV2 encryption. label is a5 5a for commands and 5a a5
+// for responses.
+func (a aesSuite) iv(l0, l1 byte, ti []byte, ctr uint16) []byte {
+	iv := make([]byte, aes.BlockSize)
+	iv[0], iv[1] = l0, l1
+	copy(iv[2:6], ti)
+	binary.LittleEndian.PutUint16(iv[6:8], ctr)
+	a.encKey.Encrypt(iv, iv)
+	return iv
+}
+
+func (a aesSuite) encrypt(ti []byte, ctr uint16, data []byte) []byte {
+	out := make([]byte, len(data))
+	cipher.NewCBCEncrypter(a.encKey, a.iv(0xa5, 0x5a, ti, ctr)).CryptBlocks(out, data)
+	return out
+}
+
+func (a aesSuite) decrypt(ti []byte, ctr uint16, data []byte) []byte {
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(a.encKey, a.iv(0x5a, 0xa5, ti, ctr)).CryptBlocks(out, data)
+	return out
+}
+
+// Compute the MAC over a command or response and truncate it.
+func (s *ev2Session) macFor(code byte, ctr uint16, header, data []byte) []byte {
+	msg := make([]byte, 0, 7+len(header)+len(data))
+	msg = append(msg, code, byte(ctr), byte(ctr>>8))
+	msg = append(msg, s.ti[:]...)
+	msg = append(msg, header...)
+	msg = append(msg, data...)
+	return cmac.Truncate(s.suite.mac(msg))
+}
+
+// Apply secure messaging to a command and return the payload to send.
+func (s *ev2Session) wrap(cmd byte, header, data []byte, commMode byte) []byte {
+	if commMode == Enciphered && len(data) > 0 {
+		data = s.suite.encrypt(s.ti[:], s.cmdCtr, pad80(data))
+	}
+
+	payload := append(append([]byte{}, header...), data...)
+	if commMode != Plain {
+		payload = append(payload, s.macFor(cmd, s.cmdCtr, header, data)...)
+	}
+
+	return payload
+}
+
+// Remove secure messaging from a successful response and advance the command
+// counter.
+func (s *ev2Session) unwrap(resp []byte, commMode byte) ([]byte, error) {
+	ctr := s.cmdCtr + 1
+	s.cmdCtr = ctr
+	if commMode == Plain {
+		return resp, nil
+	}
+
+	if len(resp) < 8 {
+		return nil, Error(LengthError)
+	}
+
+	data, mac := resp[:len(resp)-8], resp[len(resp)-8:]
+	if subtle.ConstantTimeCompare(mac, s.macFor(OperationOK, ctr, nil, data)) != 1 {
+		return nil, Error(CryptoError)
+	}
+
+	if commMode != Enciphered || len(data) == 0 {
+		return data, nil
+	}
+
+	if len(data)%aes.BlockSize != 0 {
+		return nil, Error(LengthError)
+	}
+
+	return unpad80(s.suite.decrypt(s.ti[:], ctr, data))
+}
+
+// Pad data to a multiple of 16 bytes using ISO/IEC 9797-1 padding method 2.
+// Padding is always added.
+func pad80(data []byte) []byte {
+	n := (len(data)/aes.BlockSize + 1) * aes.BlockSize
+	p := make([]byte, n)
+	copy(p, data)
+	p[len(data)] = 0x80
+	return p
+}
+
+// Remove ISO/IEC 9797-1 padding method 2.
+func unpad80(data []byte) ([]byte, error) {
+	i := bytes.LastIndexByte(data, 0x80)
+	if i < 0 || len(data)-i > aes.BlockSize {
+		return nil, Error(CryptoError)
+	}
+
+	for _, b := range data[i+1:] {
+		if b != 0 {
+			return nil, Error(CryptoError)
+		}
+	}
+
+	return data[:i], nil
+}
+
+// Rotate a random number left by one byte as done in all DESFire
+// authentication protocols.
+func rotl(rnd []byte) []byte {
+	return append(append([]byte{}, rnd[1:]...), rnd[0])
+}
+
+// Compute the 26 byte core of the session vectors used to derive EV2 and LRP
+// session keys: RndA[15..14] || RndA[13..8] ^ RndB[15..10] || RndB[9..0] ||
+// RndA[7..0] in NXP notation.
+func sessionVectorCore(rndA, rndB []byte) []byte {
+	sv := make([]byte, 0, 26)
+	sv = append(sv, rndA[0:2]...)
+	for i := 0; i < 6; i++ {
+		sv = append(sv, rndA[2+i]^rndB[i])
+	}
+
+	sv = append(sv, rndB[6:16]...)
+	sv = append(sv, rndA[8:16]...)
+	return sv
+}
+
+// Generate a random number for authentication.
+func randomBytes(n int) []byte {
+	rnd := make([]byte, n)
+	_, err := rand.Read(rnd)
+	if err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+
+	return rnd
+}
+
+// Drop the secure messaging session, if any, and record that the tag is not
+// authenticated.
+func (t DESFireTag) dropSession() {
+	if t.state != nil {
+		t.state.ev2 = nil
+		t.authenticated(AuthNone, 0, 0, nil)
+	}
+}
+
+// Perform the two pass EV2 authentication with key using command cmd and
+// parameters param. Return TI, RndA and RndB on success.
+func (t DESFireTag) authenticateEV2(cmd byte, param []byte, key cipher.Block) (rndA, rndB, resp []byte, err error) {
+	t.dropSession()
+
+	status, ekRndB, err := t.transceive(cmd, param)
+	if err != nil {
+		return
+	}
+
+	if status != AdditionalFrame {
+		err = Error(status)
+		return
+	}
+
+	if len(ekRndB) != aes.BlockSize {
+		err = Error(LengthError)
+		return
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	rndB = make([]byte, aes.BlockSize)
+	cipher.NewCBCDecrypter(key, iv).CryptBlocks(rndB, ekRndB)
+
+	rndA = randomBytes(aes.BlockSize)
+	msg := append(append([]byte{}, rndA...), rotl(rndB)...)
+	cipher.NewCBCEncrypter(key, iv).CryptBlocks(msg, msg)
+
+	status, ekResp, err := t.transceive(AdditionalFrame, msg)
+	if err != nil {
+		return
+	}
+
+	if status != OperationOK {
+		err = Error(status)
+		return
+	}
+
+	if len(ekResp)%aes.BlockSize != 0 || len(ekResp) == 0 {
+		err = Error(LengthError)
+		return
+	}
+
+	resp = make([]byte, len(ekResp))
+	cipher.NewCBCDecrypter(key, iv).CryptBlocks(resp, ekResp)
+	return
+}
+
+// Derive the EV2 session keys from the key and random numbers.
+func ev2SessionSuite(key cipher.Block, rndA, rndB []byte) aesSuite {
+	core := sessionVectorCore(rndA, rndB)
+	sv1 := append([]byte{0xa5, 0x5a, 0x00, 0x01, 0x00, 0x80}, core...)
+	sv2 := append([]byte{0x5a, 0xa5, 0x00, 0x01, 0x00, 0x80}, core...)
+
+	// AES keys are always the right size, errors cannot happen
+	macRaw := cmac.Sum(key, sv2)
+	enc, _ := aes.NewCipher(cmac.Sum(key, sv1))
+	mac, _ := aes.NewCipher(macRaw)
+	return aesSuite{encKey: enc, macKey: mac, macRaw: macRaw}
+}
+
+// Authenticate with the AES key keyNo using the EV2 authentication protocol
+// (AuthenticateEV2First) and establish an EV2 secure messaging session. This
+// is supported by DESFire EV2 and later, DESFire Light, and NTAG 424 DNA.
+// Commands sent with Command() and the functions built on it are protected by
+// this session; the libfreefare based functions do not know about it. A
+// TagStateError is returned if t has no state to keep the session in, i.e.
+// if it was not obtained from NewTag() or GetTags().
+func (t DESFireTag) AuthenticateEV2First(keyNo byte, key [16]byte) error {
+	if t.state == nil {
+		return Error(TagStateError)
+	}
+
+	b, _ := aes.NewCipher(key[:])
+	rndA, rndB, resp, err := t.authenticateEV2(cmdAuthenticateEV2First, []byte{keyNo, 0x00}, b)
+	if err != nil {
+		return err
+	}
+
+	// TI || RndA' || PDcap2 || PCDcap2
+	if len(resp) != 32 {
+		return Error(LengthError)
+	}
+
+	if subtle.ConstantTimeCompare(resp[4:20], rotl(rndA)) != 1 {
+		return Error(AuthenticationError)
+	}
+
+	s := &ev2Session{keyNo: keyNo, suite: ev2SessionSuite(b, rndA, rndB), rndA: rndA, rndB: rndB}
+	copy(s.ti[:], resp[0:4])
+	t.state.ev2 = s
+	t.authenticated(AuthEV2, keyNo, MIFARE_KEY_AES128, nil)
+
+	return nil
+}
+
+// Authenticate with the AES key keyNo using AuthenticateEV2NonFirst. This
+// switches the keys of an existing EV2 secure messaging session established
+// with AuthenticateEV2First(), keeping transaction identifier and command
+// counter. If there is no such session, a TagStateError is returned.
+func (t DESFireTag) AuthenticateEV2NonFirst(keyNo byte, key [16]byte) error {
+	if t.state == nil || t.state.ev2 == nil {
+		return Error(TagStateError)
+	}
+
+	old := t.state.ev2
+	if _, ok := old.suite.(aesSuite); !ok {
+		return Error(TagStateError)
+	}
+
+	b, _ := aes.NewCipher(key[:])
+	rndA, rndB, resp, err := t.authenticateEV2(cmdAuthenticateEV2NonFirst, []byte{keyNo}, b)
+	if err != nil {
+		return err
+	}
+
+	// RndA'
+	if len(resp) != 16 {
+		return Error(LengthError)
+	}
+
+	if subtle.ConstantTimeCompare(resp, rotl(rndA)) != 1 {
+		return Error(AuthenticationError)
+	}
+
+	t.state.ev2 = &ev2Session{
+		keyNo:  keyNo,
+		ti:     old.ti,
+		cmdCtr: old.cmdCtr,
+		suite:  ev2SessionSuite(b, rndA, rndB),
+		rndA:   rndA,
+		rndB:   rndB,
+	}
+	t.authenticated(AuthEV2, keyNo, MIFARE_KEY_AES128, nil)
+
+	return nil
+}
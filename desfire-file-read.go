@@ -0,0 +1,120 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+// Maximum number of bytes requested from the tag in one call to ReadData() or
+// ReadRecords() by ReadFile() and ReadAllRecords(). The tag splits longer
+// responses into frames anyway, but keeping each request small bounds the
+// size of the scratch buffer and the time spent in one exchange.
+const readChunkSize = 256
+
+// Read the entire content of the standard or backup data file fileNo. The
+// file size is taken from FileSettings() and the file is read in chunks of
+// readChunkSize bytes. The slice returned is exactly as long as the file.
+func (t DESFireTag) ReadFile(fileNo byte) ([]byte, error) {
+	fs, err := t.FileSettings(fileNo)
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.FileType != StandardDataFile && fs.FileType != BackupDataFile {
+		return nil, Error(ParameterError)
+	}
+
+	data := make([]byte, fs.FileSize)
+	for off := 0; off < len(data); {
+		end := off + readChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		n, err := t.ReadData(fileNo, int64(off), data[off:end])
+		if err != nil {
+			return nil, err
+		}
+
+		if n != end-off {
+			// short read, the tag returned less than asked
+			return nil, Error(LengthError)
+		}
+
+		off = end
+	}
+
+	return data, nil
+}
+
+// Read all records currently stored in the linear or cyclic record file
+// fileNo. The records are returned in chronological order, i.e. the oldest
+// record comes first and the most recent record comes last. Record size and
+// number of records are taken from FileSettings(). An empty record file
+// yields an empty slice.
+func (t DESFireTag) ReadAllRecords(fileNo byte) ([][]byte, error) {
+	fs, err := t.FileSettings(fileNo)
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.FileType != LinearRecordFileWithBackup && fs.FileType != CyclicRecordFileWithBackup {
+		return nil, Error(ParameterError)
+	}
+
+	return t.readRecordRange(fileNo, 0, int(fs.CurrentNumberOfRecords), int(fs.RecordSize))
+}
+
+// Read the n records of size recordSize from the record file fileNo whose
+// record offsets are off to off+n-1 (record offset 0 being the most recent
+// record) and return them in chronological order. The records are read in
+// chunks of at most readChunkSize bytes (but at least one record).
+func (t DESFireTag) readRecordRange(fileNo byte, off, n, recordSize int) ([][]byte, error) {
+	data := make([]byte, n*recordSize)
+
+	chunk := readChunkSize / recordSize
+	if chunk < 1 {
+		chunk = 1
+	}
+
+	// The tag returns the records requested oldest first. To assemble
+	// them in chronological order, read chunks starting with the oldest
+	// records, i.e. the highest record offsets.
+	pos := 0
+	for end := off + n; end > off; {
+		count := chunk
+		if count > end-off {
+			count = end - off
+		}
+
+		start := end - count
+		buf := data[pos : pos+count*recordSize]
+		r, err := t.readRecords(fileNo, int64(start), count, recordSize, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		if r != len(buf) {
+			return nil, Error(LengthError)
+		}
+
+		pos += len(buf)
+		end = start
+	}
+
+	records := make([][]byte, n)
+	for i := range records {
+		records[i] = data[i*recordSize : (i+1)*recordSize : (i+1)*recordSize]
+	}
+
+	return records, nil
+}
@@ -39,7 +39,6 @@ typedef struct {
 } linear_record_file;
 */
 import "C"
-import "strconv"
 import "unsafe"
 
 // DESFire file types as used in DESFireFileSettings
@@ -62,12 +61,10 @@ const (
 // support union types, this struct contains all union members laid out
 // sequentially. Only the set of members denoted by FileType is valid. Use the
 // supplied constants for FileType.
-//
-// Use the function SplitDESFireAccessRights() to split the AccessRights field.
 type DESFireFileSettings struct {
 	FileType              byte
 	CommunicationSettings byte
-	AccessRights          uint16
+	AccessRights          DESFireAccessRights
 
 	// FileType == STANDARD_DATA_FILE || FileType == BACKUP_DATA_FILE
 	FileSize uint32
@@ -135,6 +132,9 @@ func SplitDESFireAccessRights(ar uint16) (read, write, readWrite, changeAccessRi
 }
 
 // Retrieve the settings of the file fileNo of the selected application of t.
+// For files of a type this wrapper does not know (e.g. the TransactionMAC
+// files of DESFire EV2 tags), only FileType, CommunicationSettings, and
+// AccessRights are filled in and an UnknownFileType error is returned.
 func (t DESFireTag) FileSettings(fileNo byte) (DESFireFileSettings, error) {
 	var cfs C.struct_mifare_desfire_file_settings
 	r, err := C.mifare_desfire_get_file_settings(t.ctag, C.uint8_t(fileNo), &cfs)
@@ -146,9 +146,10 @@ func (t DESFireTag) FileSettings(fileNo byte) (DESFireFileSettings, error) {
 	fs := DESFireFileSettings{
 		FileType:              byte(cfs.file_type),
 		CommunicationSettings: byte(cfs.communication_settings),
-		AccessRights:          uint16(cfs.access_rights),
 	}
 
+	fs.AccessRights.Unmarshal(uint16(cfs.access_rights))
+
 	sptr := unsafe.Pointer(&cfs.settings[0])
 	switch fs.FileType {
 	case StandardDataFile:
@@ -173,18 +174,20 @@ func (t DESFireTag) FileSettings(fileNo byte) (DESFireFileSettings, error) {
 		fs.CurrentNumberOfRecords = uint32(lrf.current_number_of_records)
 
 	default:
-		panic("Unexpected file type " + strconv.Itoa(int(fs.FileType)))
+		return fs, Error(UnknownFileType)
 	}
 
 	return fs, nil
 }
 
 // Change the communication settings and access rights of file fileNo of the
-// selected application of t. Use the function MakeDESFireAccessRights() to
-// create a suitable accessRights parameter.
-func (t DESFireTag) ChangeFileSettings(fileNo, communicationSettings byte, accessRights uint16) error {
+// selected application of t.
+func (t DESFireTag) ChangeFileSettings(fileNo, communicationSettings byte, accessRights DESFireAccessRights) error {
+	t.forgetFile(fileNo)
+
 	r, err := C.mifare_desfire_change_file_settings(
-		t.ctag, C.uint8_t(fileNo), C.uint8_t(communicationSettings), C.uint16_t(accessRights))
+		t.ctag, C.uint8_t(fileNo), C.uint8_t(communicationSettings),
+		C.uint16_t(accessRights.Marshal()))
 	if r != 0 {
 		return t.TranslateError(err)
 	}
@@ -198,23 +201,25 @@ func (t DESFireTag) ChangeFileSettings(fileNo, communicationSettings byte, acces
 func (t DESFireTag) CreateDataFile(
 	fileNo byte,
 	communicationSettings byte,
-	accessRights uint16,
+	accessRights DESFireAccessRights,
 	fileSize uint32,
 	isBackup bool,
 ) error {
+	t.forgetFile(fileNo)
+
 	var r C.int
 	var err error
 
 	if isBackup {
-		r, err = C.mifare_desfire_create_std_data_file(
+		r, err = C.mifare_desfire_create_backup_data_file(
 			t.ctag, C.uint8_t(fileNo),
 			C.uint8_t(communicationSettings),
-			C.uint16_t(accessRights), C.uint32_t(fileSize))
+			C.uint16_t(accessRights.Marshal()), C.uint32_t(fileSize))
 	} else {
-		r, err = C.mifare_desfire_create_backup_data_file(
+		r, err = C.mifare_desfire_create_std_data_file(
 			t.ctag, C.uint8_t(fileNo),
 			C.uint8_t(communicationSettings),
-			C.uint16_t(accessRights), C.uint32_t(fileSize))
+			C.uint16_t(accessRights.Marshal()), C.uint32_t(fileSize))
 	}
 
 	if r != 0 {
@@ -231,25 +236,27 @@ func (t DESFireTag) CreateDataFile(
 func (t DESFireTag) CreateDataFileIso(
 	fileNo byte,
 	communicationSettings byte,
-	accessRights uint16,
+	accessRights DESFireAccessRights,
 	fileSize uint32,
 	isoFileId uint16,
 	isBackup bool,
 ) error {
+	t.forgetFile(fileNo)
+
 	var r C.int
 	var err error
 
 	if isBackup {
-		r, err = C.mifare_desfire_create_std_data_file_iso(
+		r, err = C.mifare_desfire_create_backup_data_file_iso(
 			t.ctag, C.uint8_t(fileNo),
 			C.uint8_t(communicationSettings),
-			C.uint16_t(accessRights), C.uint32_t(fileSize),
+			C.uint16_t(accessRights.Marshal()), C.uint32_t(fileSize),
 			C.uint16_t(isoFileId))
 	} else {
-		r, err = C.mifare_desfire_create_backup_data_file_iso(
+		r, err = C.mifare_desfire_create_std_data_file_iso(
 			t.ctag, C.uint8_t(fileNo),
 			C.uint8_t(communicationSettings),
-			C.uint16_t(accessRights), C.uint32_t(fileSize),
+			C.uint16_t(accessRights.Marshal()), C.uint32_t(fileSize),
 			C.uint16_t(isoFileId))
 	}
 
@@ -265,14 +272,16 @@ func (t DESFireTag) CreateDataFileIso(
 func (t DESFireTag) CreateValueFile(
 	fileNo byte,
 	communicationSettings byte,
-	accessRights uint16,
+	accessRights DESFireAccessRights,
 	lowerLimit, upperLimit, value int32,
 	limitedCreditEnable byte,
 ) error {
+	t.forgetFile(fileNo)
+
 	r, err := C.mifare_desfire_create_value_file(
 		t.ctag, C.uint8_t(fileNo),
 		C.uint8_t(communicationSettings),
-		C.uint16_t(accessRights), C.int32_t(lowerLimit),
+		C.uint16_t(accessRights.Marshal()), C.int32_t(lowerLimit),
 		C.int32_t(upperLimit), C.int32_t(value),
 		C.uint8_t(limitedCreditEnable))
 	if r != 0 {
@@ -290,24 +299,26 @@ func (t DESFireTag) CreateValueFile(
 func (t DESFireTag) CreateRecordFile(
 	fileNo byte,
 	communicationSettings byte,
-	accessRights uint16,
+	accessRights DESFireAccessRights,
 	recordSize uint32,
 	maxNumberOfRecords uint32,
 	isCyclic bool,
 ) error {
+	t.forgetFile(fileNo)
+
 	var r C.int
 	var err error
 	if isCyclic {
 		r, err = C.mifare_desfire_create_cyclic_record_file(
 			t.ctag, C.uint8_t(fileNo),
 			C.uint8_t(communicationSettings),
-			C.uint16_t(accessRights), C.uint32_t(recordSize),
+			C.uint16_t(accessRights.Marshal()), C.uint32_t(recordSize),
 			C.uint32_t(maxNumberOfRecords))
 	} else {
 		r, err = C.mifare_desfire_create_linear_record_file(
 			t.ctag, C.uint8_t(fileNo),
 			C.uint8_t(communicationSettings),
-			C.uint16_t(accessRights), C.uint32_t(recordSize),
+			C.uint16_t(accessRights.Marshal()), C.uint32_t(recordSize),
 			C.uint32_t(maxNumberOfRecords))
 	}
 
@@ -326,25 +337,27 @@ func (t DESFireTag) CreateRecordFile(
 func (t DESFireTag) CreateRecordFileIso(
 	fileNo byte,
 	communicationSettings byte,
-	accessRights uint16,
+	accessRights DESFireAccessRights,
 	recordSize uint32,
 	maxNumberOfRecords uint32,
 	isoFileId uint16,
 	isCyclic bool,
 ) error {
+	t.forgetFile(fileNo)
+
 	var r C.int
 	var err error
 	if isCyclic {
 		r, err = C.mifare_desfire_create_cyclic_record_file_iso(
 			t.ctag, C.uint8_t(fileNo),
 			C.uint8_t(communicationSettings),
-			C.uint16_t(accessRights), C.uint32_t(recordSize),
+			C.uint16_t(accessRights.Marshal()), C.uint32_t(recordSize),
 			C.uint32_t(maxNumberOfRecords), C.uint16_t(isoFileId))
 	} else {
 		r, err = C.mifare_desfire_create_linear_record_file_iso(
 			t.ctag, C.uint8_t(fileNo),
 			C.uint8_t(communicationSettings),
-			C.uint16_t(accessRights), C.uint32_t(recordSize),
+			C.uint16_t(accessRights.Marshal()), C.uint32_t(recordSize),
 			C.uint32_t(maxNumberOfRecords), C.uint16_t(isoFileId))
 	}
 
@@ -357,6 +370,8 @@ func (t DESFireTag) CreateRecordFileIso(
 
 // Remove the file fileNo from the selected application
 func (t DESFireTag) DeleteFile(fileNo byte) error {
+	t.forgetFile(fileNo)
+
 	r, err := C.mifare_desfire_delete_file(t.ctag, C.uint8_t(fileNo))
 	if r != 0 {
 		return t.TranslateError(err)
@@ -0,0 +1,282 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+// An inventory of a DESFire tag as returned by Inventory(). Information the
+// tag refused to give out without authentication is missing; the names of
+// the queries refused are listed in Denied. The structure is meant to be
+// marshalled to JSON for card audits.
+type DESFireInventory struct {
+	Version      DESFireVersionInfo       `json:"version"`
+	FreeMem      *uint32                  `json:"free_mem,omitempty"`
+	KeySettings  *DESFireKeySettings      `json:"key_settings,omitempty"`
+	KeyVersion   *byte                    `json:"key_version,omitempty"`
+	Applications []DESFireApplicationInfo `json:"applications"`
+	Denied       []string                 `json:"denied,omitempty"`
+}
+
+// Inventory of one application of a DESFire tag. The ISO file ID and DF
+// name are only known for applications created with CreateApplicationIso()
+// and only if the tag gave out the list of DF names.
+type DESFireApplicationInfo struct {
+	AID         uint32              `json:"aid"`
+	ISOFileID   *uint16             `json:"iso_file_id,omitempty"`
+	DFName      []byte              `json:"df_name,omitempty"`
+	KeySettings *DESFireKeySettings `json:"key_settings,omitempty"`
+	KeyVersions []int               `json:"key_versions,omitempty"`
+	ISOFileIDs  []uint16            `json:"iso_file_ids,omitempty"`
+	Files       []DESFireFileInfo   `json:"files"`
+	Denied      []string            `json:"denied,omitempty"`
+}
+
+// Inventory of one file of a DESFire application. Unsupported is set for
+// files of a type the wrapper does not know; only the file type,
+// communication settings, and access rights are reported for them.
+type DESFireFileInfo struct {
+	FileNo      byte                 `json:"file_no"`
+	Settings    *DESFireFileSettings `json:"settings,omitempty"`
+	Unsupported bool                 `json:"unsupported,omitempty"`
+}
+
+// Report if err is the tag refusing to answer without (suitable)
+// authentication.
+func isDenied(err error) bool {
+	e, ok := err.(Error)
+	return ok && (e == PermissionError || e == AuthenticationError)
+}
+
+// Append query to the list of denied queries unless already present.
+func appendDenied(denied []string, query string) []string {
+	for _, q := range denied {
+		if q == query {
+			return denied
+		}
+	}
+
+	return append(denied, query)
+}
+
+// Retrieve the versions of keys 0 to n-1 of the selected application. The
+// versions are returned as a []int so they marshal to a JSON array instead
+// of a base64 string.
+func (t DESFireTag) keyVersions(n byte) ([]int, error) {
+	versions := make([]int, n)
+	for keyNo := range versions {
+		version, err := t.KeyVersion(byte(keyNo))
+		if err != nil {
+			return nil, err
+		}
+
+		versions[keyNo] = int(version)
+	}
+
+	return versions, nil
+}
+
+// Walk the PICC and all its applications and return an inventory of the
+// key settings, key versions, and files found. Queries refused by the tag
+// with a PermissionError or an AuthenticationError are recorded in the
+// Denied fields and otherwise skipped; all other errors abort the
+// inventory. Applications are selected in turn (which ends any
+// authentication), the PICC is selected again at the end.
+func (t DESFireTag) Inventory() (*DESFireInventory, error) {
+	return t.inventory(nil)
+}
+
+// Take the inventory like Inventory(). If keys is not nil, authenticate
+// with the PICC master key and key 0 of each application as returned by
+// keys before querying them.
+func (t DESFireTag) inventory(keys KeyProvider) (*DESFireInventory, error) {
+	var inv DESFireInventory
+	var err error
+
+	picc := NewDESFireAid(0)
+	if keys != nil {
+		err = t.selectPICC(keys)
+	} else {
+		err = t.SelectApplication(picc)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	inv.Version, err = t.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	freeMem, err := t.FreeMem()
+	switch {
+	case err == nil:
+		inv.FreeMem = &freeMem
+	case isDenied(err):
+		inv.Denied = append(inv.Denied, "FreeMem")
+	default:
+		return nil, err
+	}
+
+	settings, err := t.KeySettings()
+	switch {
+	case err == nil:
+		inv.KeySettings = &settings
+	case isDenied(err):
+		inv.Denied = append(inv.Denied, "KeySettings")
+	default:
+		return nil, err
+	}
+
+	keyVersion, err := t.KeyVersion(0)
+	switch {
+	case err == nil:
+		inv.KeyVersion = &keyVersion
+	case isDenied(err):
+		inv.Denied = append(inv.Denied, "KeyVersion")
+	default:
+		return nil, err
+	}
+
+	aids, err := t.ApplicationIds()
+	switch {
+	case err == nil:
+	case isDenied(err):
+		inv.Denied = append(inv.Denied, "ApplicationIds")
+		return &inv, nil
+	default:
+		return nil, err
+	}
+
+	var dfs []DESFireDF
+	dfs, err = t.DFNames()
+	switch {
+	case err == nil:
+	case isDenied(err):
+		inv.Denied = append(inv.Denied, "DFNames")
+	default:
+		return nil, err
+	}
+
+	inv.Applications = make([]DESFireApplicationInfo, 0, len(aids))
+	for _, aid := range aids {
+		ai, err := t.applicationInventory(aid, dfs, keys)
+		if err != nil {
+			return nil, err
+		}
+
+		inv.Applications = append(inv.Applications, *ai)
+	}
+
+	err = t.SelectApplication(picc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inv, nil
+}
+
+// Select application aid and take its inventory. dfs is the list of DF names
+// of the PICC. If keys is not nil, authenticate with key 0 of the
+// application as returned by keys first.
+func (t DESFireTag) applicationInventory(aid DESFireAid, dfs []DESFireDF, keys KeyProvider) (*DESFireApplicationInfo, error) {
+	ai := DESFireApplicationInfo{AID: aid.Aid(), Files: []DESFireFileInfo{}}
+	isISO := false
+	for i := range dfs {
+		if dfs[i].DESFireAid == aid {
+			fid := dfs[i].Fid
+			ai.ISOFileID = &fid
+			ai.DFName = dfs[i].Name
+			isISO = true
+		}
+	}
+
+	err := t.SelectApplication(aid)
+	if err != nil {
+		return nil, err
+	}
+
+	if keys != nil {
+		master, err := keys.Key(aid, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if master != nil {
+			err = t.Authenticate(0, *master)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	settings, err := t.KeySettings()
+	switch {
+	case err == nil:
+		ai.KeySettings = &settings
+		ai.KeyVersions, err = t.keyVersions(settings.MaxKeys)
+		switch {
+		case err == nil:
+		case isDenied(err):
+			ai.Denied = append(ai.Denied, "KeyVersion")
+		default:
+			return nil, err
+		}
+
+	case isDenied(err):
+		ai.Denied = append(ai.Denied, "KeySettings")
+	default:
+		return nil, err
+	}
+
+	fileNos, err := t.FileIds()
+	switch {
+	case err == nil:
+	case isDenied(err):
+		ai.Denied = append(ai.Denied, "FileIds")
+		return &ai, nil
+	default:
+		return nil, err
+	}
+
+	if isISO {
+		ai.ISOFileIDs, err = t.IsoFileIds()
+		switch {
+		case err == nil:
+		case isDenied(err):
+			ai.Denied = append(ai.Denied, "IsoFileIds")
+		default:
+			return nil, err
+		}
+	}
+
+	for _, fileNo := range fileNos {
+		fi := DESFireFileInfo{FileNo: fileNo}
+		fs, err := t.FileSettings(fileNo)
+		switch {
+		case err == nil:
+			fi.Settings = &fs
+		case err == Error(UnknownFileType):
+			fi.Settings = &fs
+			fi.Unsupported = true
+		case isDenied(err):
+			ai.Denied = appendDenied(ai.Denied, "FileSettings")
+		default:
+			return nil, err
+		}
+
+		ai.Files = append(ai.Files, fi)
+	}
+
+	return &ai, nil
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "strconv"
+import "strings"
+
+// Special values for DESFireKeySettings.ChangeKey. Values 0 to 13 denote the
+// key needed to change keys.
+const (
+	ChangeKeySameKey = 0xe // each key can only be changed with itself
+	ChangeKeyFrozen  = 0xf // no key but the master key can be changed
+)
+
+// Bits of the key settings byte
+const (
+	keySettingAllowChangeMasterKey    = 1 << 0
+	keySettingFreeDirectoryList       = 1 << 1
+	keySettingFreeCreateDelete        = 1 << 2
+	keySettingConfigurationChangeable = 1 << 3
+)
+
+// Masks for the maxKeys byte
+const (
+	maxKeysCryptoMask = 0xc0
+	maxKeysCountMask  = 0x0f
+)
+
+// The key settings of the PICC or an application. The flags and ChangeKey
+// make up the key settings byte as returned by Marshal(); MaxKeys and Crypto
+// make up the byte describing the keys of an application returned by
+// MarshalMaxKeys(). The latter cannot be changed after the application has
+// been created.
+type DESFireKeySettings struct {
+	// key number needed to change keys (0 to 13), ChangeKeySameKey, or
+	// ChangeKeyFrozen. Irrelevant for the PICC.
+	ChangeKey byte
+
+	// The key settings can be changed (with the master key).
+	ConfigurationChangeable bool
+
+	// PICC: applications can be created without authentication.
+	// Application: files can be created and deleted without
+	// authentication with the master key.
+	FreeCreateDelete bool
+
+	// Application and file IDs and settings can be retrieved without
+	// authentication with the master key.
+	FreeDirectoryList bool
+
+	// The master key can be changed.
+	AllowChangeMasterKey bool
+
+	// Number of keys (1 to 14) and their cryptography mode (CryptoDES,
+	// Crypto3k3DES, or CryptoAES).
+	MaxKeys byte
+	Crypto  byte
+}
+
+// Return the key settings byte described by s.
+func (s DESFireKeySettings) Marshal() byte {
+	b := s.ChangeKey << 4
+	if s.ConfigurationChangeable {
+		b |= keySettingConfigurationChangeable
+	}
+
+	if s.FreeCreateDelete {
+		b |= keySettingFreeCreateDelete
+	}
+
+	if s.FreeDirectoryList {
+		b |= keySettingFreeDirectoryList
+	}
+
+	if s.AllowChangeMasterKey {
+		b |= keySettingAllowChangeMasterKey
+	}
+
+	return b
+}
+
+// Return the byte describing number and cryptography mode of the keys as
+// passed to CreateApplication().
+func (s DESFireKeySettings) MarshalMaxKeys() byte {
+	return s.Crypto&maxKeysCryptoMask | s.MaxKeys&maxKeysCountMask
+}
+
+// Set s to the key settings described by the key settings byte settings and
+// the byte maxKeys describing number and cryptography mode of the keys.
+func (s *DESFireKeySettings) Unmarshal(settings, maxKeys byte) {
+	*s = DESFireKeySettings{
+		ChangeKey:               settings >> 4,
+		ConfigurationChangeable: settings&keySettingConfigurationChangeable != 0,
+		FreeCreateDelete:        settings&keySettingFreeCreateDelete != 0,
+		FreeDirectoryList:       settings&keySettingFreeDirectoryList != 0,
+		AllowChangeMasterKey:    settings&keySettingAllowChangeMasterKey != 0,
+		MaxKeys:                 maxKeys & maxKeysCountMask,
+		Crypto:                  maxKeys & maxKeysCryptoMask,
+	}
+}
+
+// Return a human readable representation of s, e.g.
+//
+//	AES keys:3 change-key:0 config-changeable free-list change-master-key
+//
+// Flags that are not set are omitted.
+func (s DESFireKeySettings) String() string {
+	var b strings.Builder
+
+	switch s.Crypto {
+	case CryptoDES:
+		b.WriteString("DES")
+	case Crypto3k3DES:
+		b.WriteString("3K3DES")
+	case CryptoAES:
+		b.WriteString("AES")
+	default:
+		b.WriteString("crypto:0x" + strconv.FormatUint(uint64(s.Crypto), 16))
+	}
+
+	b.WriteString(" keys:" + strconv.Itoa(int(s.MaxKeys)))
+
+	switch s.ChangeKey {
+	case ChangeKeySameKey:
+		b.WriteString(" change-key:same")
+	case ChangeKeyFrozen:
+		b.WriteString(" change-key:frozen")
+	default:
+		b.WriteString(" change-key:" + strconv.Itoa(int(s.ChangeKey)))
+	}
+
+	if s.ConfigurationChangeable {
+		b.WriteString(" config-changeable")
+	}
+
+	if s.FreeCreateDelete {
+		b.WriteString(" free-create-delete")
+	}
+
+	if s.FreeDirectoryList {
+		b.WriteString(" free-list")
+	}
+
+	if s.AllowChangeMasterKey {
+		b.WriteString(" change-master-key")
+	}
+
+	return b.String()
+}
@@ -20,16 +20,17 @@ import "unsafe"
 
 // This structure wraps a MifareDESFireKey.
 type DESFireKey struct {
-	key C.MifareDESFireKey
+	key     C.MifareDESFireKey
+	keyType MifareKeyType
 	*finalizee
 }
 
-func wrapDESFireKey(k C.MifareDESFireKey) *DESFireKey {
+func wrapDESFireKey(k C.MifareDESFireKey, keyType MifareKeyType) *DESFireKey {
 	if k == nil {
 		panic("C.malloc() returned nil (out of memory)")
 	}
 
-	return &DESFireKey{key: k, finalizee: newFinalizee(unsafe.Pointer(k))}
+	return &DESFireKey{key: k, keyType: keyType, finalizee: newFinalizee(unsafe.Pointer(k))}
 }
 
 // Create a new DES key. This function wraps the verbosely named function
@@ -47,7 +48,7 @@ func wrapDESFireKey(k C.MifareDESFireKey) *DESFireKey {
 //     key := NewDESFireDESKey(value)
 func NewDESFireDESKey(value [8]byte) *DESFireKey {
 	key := C.mifare_desfire_des_key_new_with_version((*C.uint8_t)(&value[0]))
-	return wrapDESFireKey(key)
+	return wrapDESFireKey(key, MIFARE_KEY_DES)
 }
 
 // Create a new 3DES key. This function wraps the verbosely named function
@@ -70,7 +71,7 @@ func NewDESFireDESKey(value [8]byte) *DESFireKey {
 //     key := NewDESFireDES3Key(value)
 func NewDESFire3DESKey(value [16]byte) *DESFireKey {
 	key := C.mifare_desfire_3des_key_new_with_version((*C.uint8_t)(&value[0]))
-	return wrapDESFireKey(key)
+	return wrapDESFireKey(key, MIFARE_KEY_2K3DES)
 }
 
 // Create a new 3K3DES key. This function wraps the verbosely named function
@@ -88,7 +89,7 @@ func NewDESFire3DESKey(value [16]byte) *DESFireKey {
 //     key := NewDESFire3K3DESKey(value)
 func NewDESFire3K3DESKey(value [24]byte) *DESFireKey {
 	key := C.mifare_desfire_3k3des_key_new_with_version((*C.uint8_t)(&value[0]))
-	return wrapDESFireKey(key)
+	return wrapDESFireKey(key, MIFARE_KEY_3K3DES)
 }
 
 // Create a new AES key. This function wraps the verbosely named function
@@ -96,7 +97,7 @@ func NewDESFire3K3DESKey(value [24]byte) *DESFireKey {
 // mifare_desfire_aes_key_new does, pass 0 as version.
 func NewDESFireAESKey(value [16]byte, version byte) *DESFireKey {
 	key := C.mifare_desfire_aes_key_new_with_version((*C.uint8_t)(&value[0]), C.uint8_t(version))
-	return wrapDESFireKey(key)
+	return wrapDESFireKey(key, MIFARE_KEY_AES128)
 }
 
 // Get the version of a Mifare DESFireKey.
@@ -104,6 +105,11 @@ func (k *DESFireKey) Version() byte {
 	return byte(C.mifare_desfire_key_get_version(k.key))
 }
 
+// Get the type of a Mifare DESFireKey.
+func (k *DESFireKey) Type() MifareKeyType {
+	return k.keyType
+}
+
 // Set the version of a Mifare DESFireKey.
 func (k *DESFireKey) SetVersion(version byte) {
 	C.mifare_desfire_key_set_version(k.key, C.uint8_t(version))
@@ -0,0 +1,431 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "fmt"
+import "strings"
+
+// Actions of a PlanStep
+const (
+	PlanCreateApplication = iota
+	PlanDeleteApplication
+	PlanCreateFile
+	PlanDeleteFile
+	PlanChangeFileSettings
+	PlanChangeKey
+	PlanChangeKeySettings
+)
+
+// One step of a LayoutPlan. FileNo is only meaningful for file actions,
+// KeyNo only for PlanChangeKey. A destructive step loses data on the card.
+// Detail is a human readable description of what changes.
+type PlanStep struct {
+	Action      int    `json:"action"`
+	AID         uint32 `json:"aid"`
+	FileNo      byte   `json:"file_no,omitempty"`
+	KeyNo       byte   `json:"key_no,omitempty"`
+	Destructive bool   `json:"destructive,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+}
+
+// The steps needed to turn a card into a given layout as computed by
+// DiffLayout(). Unlike ApplyLayout(), the plan includes deleting
+// applications and files not in the layout and recreating files whose type
+// or size differs.
+type LayoutPlan struct {
+	Steps []PlanStep `json:"steps"`
+}
+
+// Report if p contains destructive steps.
+func (p *LayoutPlan) Destructive() bool {
+	for i := range p.Steps {
+		if p.Steps[i].Destructive {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Report if p is empty, i.e. the card matches the layout.
+func (p *LayoutPlan) Empty() bool {
+	return len(p.Steps) == 0
+}
+
+// Format a single step for String().
+func (s *PlanStep) String() string {
+	var sign, what string
+	switch s.Action {
+	case PlanCreateApplication:
+		sign, what = "+", fmt.Sprintf("create application %06x", s.AID)
+	case PlanDeleteApplication:
+		sign, what = "-", fmt.Sprintf("delete application %06x", s.AID)
+	case PlanCreateFile:
+		sign, what = "+", fmt.Sprintf("create file %d in application %06x", s.FileNo, s.AID)
+	case PlanDeleteFile:
+		sign, what = "-", fmt.Sprintf("delete file %d from application %06x", s.FileNo, s.AID)
+	case PlanChangeFileSettings:
+		sign, what = "~", fmt.Sprintf("change settings of file %d in application %06x", s.FileNo, s.AID)
+	case PlanChangeKey:
+		sign, what = "~", fmt.Sprintf("change key %d of application %06x", s.KeyNo, s.AID)
+	case PlanChangeKeySettings:
+		sign, what = "~", fmt.Sprintf("change key settings of application %06x", s.AID)
+	default:
+		sign, what = "?", fmt.Sprintf("unknown action %d", s.Action)
+	}
+
+	str := sign + " " + what
+	if s.Detail != "" {
+		str += ": " + s.Detail
+	}
+
+	if s.Destructive {
+		str += " (destructive)"
+	}
+
+	return str
+}
+
+// Format p similar to the output of "terraform plan": one step per line,
+// prefixed with + for steps that create something, - for steps that delete
+// something, and ~ for steps that change something, followed by a summary
+// like "Plan: 2 to create, 2 to change, 1 to delete (destructive)."
+func (p *LayoutPlan) String() string {
+	if p.Empty() {
+		return "No changes. The card matches the layout.\n"
+	}
+
+	var b strings.Builder
+	var create, change, del int
+	for i := range p.Steps {
+		b.WriteString(p.Steps[i].String())
+		b.WriteByte('\n')
+
+		switch p.Steps[i].Action {
+		case PlanCreateApplication, PlanCreateFile:
+			create++
+		case PlanDeleteApplication, PlanDeleteFile:
+			del++
+		default:
+			change++
+		}
+	}
+
+	fmt.Fprintf(&b, "\nPlan: %d to create, %d to change, %d to delete", create, change, del)
+	if p.Destructive() {
+		b.WriteString(" (destructive)")
+	}
+
+	b.WriteString(".\n")
+	return b.String()
+}
+
+// Compute the steps needed to turn the applications and files of t into
+// layout. The card is enumerated like Inventory(), but as selecting an
+// application ends any authentication, DiffLayout() authenticates with the
+// PICC master key and key 0 of each application as returned by keys (like
+// Export()) before listing their key settings and files. keys may return a
+// nil key for applications that can be listed without authentication. If
+// the tag still refuses to list the applications, files, or settings needed,
+// an error is returned. Keys cannot be compared; key changes are only
+// planned for new applications. The PICC is selected when DiffLayout()
+// returns.
+func DiffLayout(t DESFireTag, layout *CardLayout, keys KeyProvider) (*LayoutPlan, error) {
+	err := layout.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := t.inventory(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffInventory(inv, layout)
+}
+
+// Compute the plan to turn the card described by inv into layout.
+func diffInventory(inv *DESFireInventory, layout *CardLayout) (*LayoutPlan, error) {
+	for _, q := range inv.Denied {
+		if q == "ApplicationIds" {
+			return nil, fmt.Errorf("freefare: tag refused to list applications")
+		}
+	}
+
+	plan := &LayoutPlan{Steps: []PlanStep{}}
+
+	wanted := map[uint32]bool{}
+	for i := range layout.Applications {
+		wanted[layout.Applications[i].AID] = true
+	}
+
+	present := map[uint32]*DESFireApplicationInfo{}
+	for i := range inv.Applications {
+		ai := &inv.Applications[i]
+		present[ai.AID] = ai
+		if !wanted[ai.AID] {
+			plan.Steps = append(plan.Steps, PlanStep{
+				Action:      PlanDeleteApplication,
+				AID:         ai.AID,
+				Destructive: true,
+			})
+		}
+	}
+
+	for i := range layout.Applications {
+		app := &layout.Applications[i]
+		ai := present[app.AID]
+		if ai == nil {
+			plan.Steps = append(plan.Steps, createApplicationSteps(app, "")...)
+			continue
+		}
+
+		steps, err := diffApplication(ai, app)
+		if err != nil {
+			return nil, err
+		}
+
+		plan.Steps = append(plan.Steps, steps...)
+	}
+
+	return plan, nil
+}
+
+// Return the steps to create the application app and its files. Unless empty,
+// reason explains why the application is recreated.
+func createApplicationSteps(app *ApplicationLayout, reason string) []PlanStep {
+	detail := app.KeySettings.String()
+	if reason != "" {
+		detail = reason + ", " + detail
+	}
+
+	steps := []PlanStep{{
+		Action: PlanCreateApplication,
+		AID:    app.AID,
+		Detail: detail,
+	}}
+
+	for i := range app.Files {
+		steps = append(steps, PlanStep{
+			Action: PlanCreateFile,
+			AID:    app.AID,
+			FileNo: app.Files[i].FileNo,
+			Detail: app.Files[i].describe(),
+		})
+	}
+
+	// same order as ApplyLayout()
+	for keyNo := int(app.KeySettings.MaxKeys) - 1; keyNo >= 0; keyNo-- {
+		steps = append(steps, PlanStep{
+			Action: PlanChangeKey,
+			AID:    app.AID,
+			KeyNo:  byte(keyNo),
+		})
+	}
+
+	return steps
+}
+
+// Compute the steps needed to turn the existing application ai into app.
+func diffApplication(ai *DESFireApplicationInfo, app *ApplicationLayout) ([]PlanStep, error) {
+	if ai.KeySettings == nil {
+		return nil, fmt.Errorf("freefare: tag refused to give out key settings of application %06x", app.AID)
+	}
+
+	ks := *ai.KeySettings
+	if ks.MaxKeys != app.KeySettings.MaxKeys || ks.Crypto != app.KeySettings.Crypto {
+		steps := []PlanStep{{
+			Action:      PlanDeleteApplication,
+			AID:         app.AID,
+			Destructive: true,
+			Detail:      "keys differ: " + ks.String(),
+		}}
+
+		return append(steps, createApplicationSteps(app, "recreate")...), nil
+	}
+
+	for _, q := range ai.Denied {
+		if q == "FileIds" || q == "FileSettings" {
+			return nil, fmt.Errorf("freefare: tag refused to list files of application %06x", app.AID)
+		}
+	}
+
+	var steps []PlanStep
+	if ks.Marshal() != app.KeySettings.Marshal() {
+		steps = append(steps, PlanStep{
+			Action: PlanChangeKeySettings,
+			AID:    app.AID,
+			Detail: ks.String() + " -> " + app.KeySettings.String(),
+		})
+	}
+
+	wanted := map[byte]bool{}
+	for i := range app.Files {
+		wanted[app.Files[i].FileNo] = true
+	}
+
+	present := map[byte]*DESFireFileSettings{}
+	for i := range ai.Files {
+		fi := &ai.Files[i]
+		present[fi.FileNo] = fi.Settings
+		if !wanted[fi.FileNo] {
+			steps = append(steps, PlanStep{
+				Action:      PlanDeleteFile,
+				AID:         app.AID,
+				FileNo:      fi.FileNo,
+				Destructive: true,
+			})
+		}
+	}
+
+	for i := range app.Files {
+		f := &app.Files[i]
+		fs, ok := present[f.FileNo]
+		if !ok {
+			steps = append(steps, PlanStep{
+				Action: PlanCreateFile,
+				AID:    app.AID,
+				FileNo: f.FileNo,
+				Detail: f.describe(),
+			})
+
+			continue
+		}
+
+		steps = append(steps, diffFile(app.AID, fs, f)...)
+	}
+
+	return steps, nil
+}
+
+// Compute the steps needed to turn the existing file with settings fs into
+// the file described by f.
+func diffFile(aid uint32, fs *DESFireFileSettings, f *FileLayout) []PlanStep {
+	want := f.settings()
+	if !sameFileStructure(fs, &want) {
+		return []PlanStep{{
+			Action:      PlanDeleteFile,
+			AID:         aid,
+			FileNo:      f.FileNo,
+			Destructive: true,
+			Detail:      "recreate, was " + describeFileSettings(fs),
+		}, {
+			Action: PlanCreateFile,
+			AID:    aid,
+			FileNo: f.FileNo,
+			Detail: f.describe(),
+		}}
+	}
+
+	if fs.CommunicationSettings != want.CommunicationSettings || fs.AccessRights != want.AccessRights {
+		return []PlanStep{{
+			Action: PlanChangeFileSettings,
+			AID:    aid,
+			FileNo: f.FileNo,
+			Detail: commName(fs.CommunicationSettings) + " " + fs.AccessRights.String() +
+				" -> " + f.Comm + " " + f.AccessRights.String(),
+		}}
+	}
+
+	return nil
+}
+
+// Report if the file settings a and b describe files of the same type and
+// size, i.e. the parts of the settings that cannot be changed without
+// recreating the file.
+func sameFileStructure(a, b *DESFireFileSettings) bool {
+	if a.FileType != b.FileType {
+		return false
+	}
+
+	switch a.FileType {
+	case StandardDataFile, BackupDataFile:
+		return a.FileSize == b.FileSize
+	case ValueFileWithBackup:
+		return a.LowerLimit == b.LowerLimit && a.UpperLimit == b.UpperLimit &&
+			a.LimitedCreditEnabled&1 == b.LimitedCreditEnabled&1
+	default:
+		return a.RecordSize == b.RecordSize && a.MaxNumberOfRecords == b.MaxNumberOfRecords
+	}
+}
+
+// Return the file settings of a file created from f. f must be valid.
+func (f *FileLayout) settings() DESFireFileSettings {
+	ft, _ := f.FileType()
+	comm, _ := f.CommMode()
+	fs := DESFireFileSettings{
+		FileType:              ft,
+		CommunicationSettings: comm,
+		AccessRights:          f.AccessRights,
+	}
+
+	switch ft {
+	case StandardDataFile, BackupDataFile:
+		fs.FileSize = f.Size
+	case ValueFileWithBackup:
+		fs.LowerLimit = f.LowerLimit
+		fs.UpperLimit = f.UpperLimit
+		if f.LimitedCredit {
+			fs.LimitedCreditEnabled = 1
+		}
+	default:
+		fs.RecordSize = f.RecordSize
+		fs.MaxNumberOfRecords = f.MaxRecords
+	}
+
+	return fs
+}
+
+// Return a short description of the file described by f.
+func (f *FileLayout) describe() string {
+	fs := f.settings()
+	return describeFileSettings(&fs)
+}
+
+// Return the name of communication mode mode as used in a FileLayout.
+func commName(mode byte) string {
+	for name, m := range layoutCommModes {
+		if m == mode {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("comm:%#02x", mode)
+}
+
+// Return a short description of a file with settings fs, e.g.
+// "standard 32 bytes plain R:1 W:1 RW:1 C:0".
+func describeFileSettings(fs *DESFireFileSettings) string {
+	var what string
+	switch fs.FileType {
+	case StandardDataFile:
+		what = fmt.Sprintf("standard %d bytes", fs.FileSize)
+	case BackupDataFile:
+		what = fmt.Sprintf("backup %d bytes", fs.FileSize)
+	case ValueFileWithBackup:
+		what = fmt.Sprintf("value %d..%d", fs.LowerLimit, fs.UpperLimit)
+		if fs.LimitedCreditEnabled&1 != 0 {
+			what += " limited-credit"
+		}
+	case LinearRecordFileWithBackup:
+		what = fmt.Sprintf("linear %d*%d bytes", fs.MaxNumberOfRecords, fs.RecordSize)
+	case CyclicRecordFileWithBackup:
+		what = fmt.Sprintf("cyclic %d*%d bytes", fs.MaxNumberOfRecords, fs.RecordSize)
+	default:
+		what = fmt.Sprintf("type %d", fs.FileType)
+	}
+
+	return what + " " + commName(fs.CommunicationSettings) + " " + fs.AccessRights.String()
+}
@@ -0,0 +1,582 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "fmt"
+
+// A declarative description of the applications and files of a DESFire
+// card, meant to be stored as JSON and applied to many cards with
+// ApplyLayout(). Keys are not part of the layout; they are obtained from a
+// KeyProvider.
+type CardLayout struct {
+	Applications []ApplicationLayout `json:"applications"`
+}
+
+// The layout of one application. KeySettings includes the number of keys
+// and their cryptography mode.
+type ApplicationLayout struct {
+	AID         uint32             `json:"aid"`
+	KeySettings DESFireKeySettings `json:"key_settings"`
+	Files       []FileLayout       `json:"files"`
+}
+
+// The layout of one file. Type is one of "standard", "backup", "value",
+// "linear", or "cyclic"; Comm is one of "plain", "maced", or "enciphered".
+// Which of the remaining fields are used depends on Type. Data is the
+// initial content of standard and backup data files and may be shorter
+// than Size.
+type FileLayout struct {
+	FileNo       byte                `json:"file_no"`
+	Type         string              `json:"type"`
+	Comm         string              `json:"comm"`
+	AccessRights DESFireAccessRights `json:"access_rights"`
+
+	// Type == "standard" || Type == "backup"
+	Size uint32 `json:"size,omitempty"`
+	Data []byte `json:"data,omitempty"`
+
+	// Type == "value"
+	LowerLimit    int32 `json:"lower_limit,omitempty"`
+	UpperLimit    int32 `json:"upper_limit,omitempty"`
+	Value         int32 `json:"value,omitempty"`
+	LimitedCredit bool  `json:"limited_credit,omitempty"`
+
+	// Type == "linear" || Type == "cyclic"
+	RecordSize uint32 `json:"record_size,omitempty"`
+	MaxRecords uint32 `json:"max_records,omitempty"`
+}
+
+// Provides the keys to use with ApplyLayout() and related functions. Key()
+// returns key keyNo of application aid, with aid 0 denoting the PICC. A nil
+// key and a nil error for the PICC master key mean that no authentication
+// with the PICC master key is needed.
+type KeyProvider interface {
+	Key(aid DESFireAid, keyNo byte) (*DESFireKey, error)
+}
+
+// Names of file types and communication modes in a FileLayout
+var (
+	layoutFileTypes = map[string]byte{
+		"standard": StandardDataFile,
+		"backup":   BackupDataFile,
+		"value":    ValueFileWithBackup,
+		"linear":   LinearRecordFileWithBackup,
+		"cyclic":   CyclicRecordFileWithBackup,
+	}
+
+	layoutCommModes = map[string]byte{
+		"plain":      Plain,
+		"maced":      Maced,
+		"enciphered": Enciphered,
+	}
+)
+
+// Return the file type of f as found in DESFireFileSettings.FileType.
+func (f *FileLayout) FileType() (byte, error) {
+	ft, ok := layoutFileTypes[f.Type]
+	if !ok {
+		return 0, fmt.Errorf("freefare: file %d: unknown file type %q", f.FileNo, f.Type)
+	}
+
+	return ft, nil
+}
+
+// Return the communication mode of f as found in
+// DESFireFileSettings.CommunicationSettings.
+func (f *FileLayout) CommMode() (byte, error) {
+	mode, ok := layoutCommModes[f.Comm]
+	if !ok {
+		return 0, fmt.Errorf("freefare: file %d: unknown communication mode %q", f.FileNo, f.Comm)
+	}
+
+	return mode, nil
+}
+
+// Check l for errors that can be found without a card: unknown names,
+// duplicate AIDs or file numbers, invalid key counts, and initial data
+// exceeding the file size.
+func (l *CardLayout) Validate() error {
+	aids := map[uint32]bool{}
+	for i := range l.Applications {
+		app := &l.Applications[i]
+		if app.AID == 0 || app.AID > 0xffffff {
+			return fmt.Errorf("freefare: invalid AID %06x", app.AID)
+		}
+
+		if aids[app.AID] {
+			return fmt.Errorf("freefare: duplicate AID %06x", app.AID)
+		}
+
+		aids[app.AID] = true
+
+		ks := app.KeySettings
+		if ks.MaxKeys < 1 || ks.MaxKeys > 14 {
+			return fmt.Errorf("freefare: application %06x: invalid number of keys %d", app.AID, ks.MaxKeys)
+		}
+
+		if ks.Crypto != CryptoDES && ks.Crypto != Crypto3k3DES && ks.Crypto != CryptoAES {
+			return fmt.Errorf("freefare: application %06x: invalid cryptography mode %#02x", app.AID, ks.Crypto)
+		}
+
+		files := map[byte]bool{}
+		for j := range app.Files {
+			f := &app.Files[j]
+			if files[f.FileNo] {
+				return fmt.Errorf("freefare: application %06x: duplicate file %d", app.AID, f.FileNo)
+			}
+
+			files[f.FileNo] = true
+
+			ft, err := f.FileType()
+			if err != nil {
+				return err
+			}
+
+			_, err = f.CommMode()
+			if err != nil {
+				return err
+			}
+
+			switch ft {
+			case StandardDataFile, BackupDataFile:
+				if uint32(len(f.Data)) > f.Size {
+					return fmt.Errorf("freefare: file %d: initial data exceeds file size", f.FileNo)
+				}
+
+			case LinearRecordFileWithBackup, CyclicRecordFileWithBackup:
+				if f.RecordSize == 0 || f.MaxRecords == 0 {
+					return fmt.Errorf("freefare: file %d: record size and number of records must not be zero", f.FileNo)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// The key settings used while an application is being set up: the master
+// key may change all keys and the configuration. The final key settings
+// from the layout are applied once keys and files are in place.
+func provisioningKeySettings(ks DESFireKeySettings) DESFireKeySettings {
+	return DESFireKeySettings{
+		ChangeKey:               0,
+		ConfigurationChangeable: true,
+		FreeDirectoryList:       true,
+		AllowChangeMasterKey:    true,
+		MaxKeys:                 ks.MaxKeys,
+		Crypto:                  ks.Crypto,
+	}
+}
+
+// Return the key all keys of a new application with cryptography mode crypto
+// are set to.
+func defaultKey(crypto byte) *DESFireKey {
+	switch crypto {
+	case Crypto3k3DES:
+		return NewDESFire3K3DESKey([24]byte{})
+	case CryptoAES:
+		return NewDESFireAESKey([16]byte{}, 0)
+	default:
+		return NewDESFireDESKey([8]byte{})
+	}
+}
+
+// Report if err is an AuthenticationError.
+func isAuthenticationError(err error) bool {
+	e, ok := err.(Error)
+	return ok && e == AuthenticationError
+}
+
+// Select the PICC and authenticate with the PICC master key if keys provides
+// one.
+func (t DESFireTag) selectPICC(keys KeyProvider) error {
+	picc := NewDESFireAid(0)
+	err := t.SelectApplication(picc)
+	if err != nil {
+		return err
+	}
+
+	key, err := keys.Key(picc, 0)
+	if err != nil {
+		return err
+	}
+
+	if key == nil {
+		return nil
+	}
+
+	return t.Authenticate(0, *key)
+}
+
+// Apply layout to t: create the applications and files of layout that do not
+// exist yet, set the keys of new applications to those returned by keys, and
+// bring the key settings of each application in line with the layout.
+// Existing files are left alone, except that the initial data of a data file
+// is written if the file still reads as all zeroes where the data goes; use
+// DiffLayout() to find files that differ from the layout. Applications and
+// files not in layout are not touched either.
+//
+// ApplyLayout() is idempotent: applying the same layout again does nothing,
+// and applying it to a card on which a previous attempt was interrupted
+// finishes the job. To make this work, keys of a new application are changed
+// from the default key starting with the highest key number, with key 0 last.
+// An application whose key 0 still is the default key is considered not to
+// have its keys set up yet; keys a previous attempt changed already are
+// recognized by authenticating with them. A data file created by a previous
+// attempt that was interrupted before writing its initial data is recognized
+// by its content being all zeroes; if the tag does not let the content be
+// read with the keys returned by keys, the initial data cannot be completed
+// this way. The PICC is selected when ApplyLayout() returns.
+func (t DESFireTag) ApplyLayout(layout *CardLayout, keys KeyProvider) error {
+	err := layout.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = t.selectPICC(keys)
+	if err != nil {
+		return err
+	}
+
+	aids, err := t.ApplicationIds()
+	if err != nil {
+		return err
+	}
+
+	existing := map[DESFireAid]bool{}
+	for _, aid := range aids {
+		existing[aid] = true
+	}
+
+	for i := range layout.Applications {
+		app := &layout.Applications[i]
+		aid := NewDESFireAid(app.AID)
+		if !existing[aid] {
+			err = t.selectPICC(keys)
+			if err != nil {
+				return err
+			}
+
+			err = t.CreateApplication(aid, provisioningKeySettings(app.KeySettings))
+			if err != nil {
+				return err
+			}
+		}
+
+		err = t.applyApplication(app, keys)
+		if err != nil {
+			return err
+		}
+	}
+
+	return t.SelectApplication(NewDESFireAid(0))
+}
+
+// Select the application described by app and bring its keys, files, and key
+// settings in line with app. The application is authenticated with key 0
+// first as the key settings may deny listing its files otherwise.
+func (t DESFireTag) applyApplication(app *ApplicationLayout, keys KeyProvider) error {
+	aid := NewDESFireAid(app.AID)
+	err := t.SelectApplication(aid)
+	if err != nil {
+		return err
+	}
+
+	err = t.setupKeys(aid, app.KeySettings, keys)
+	if err != nil {
+		return err
+	}
+
+	ks, err := t.KeySettings()
+	if err != nil {
+		return err
+	}
+
+	if ks.MaxKeys != app.KeySettings.MaxKeys || ks.Crypto != app.KeySettings.Crypto {
+		return fmt.Errorf("freefare: application %06x exists with different keys (%s)", app.AID, ks)
+	}
+
+	fileNos, err := t.FileIds()
+	if err != nil {
+		return err
+	}
+
+	existing := map[byte]bool{}
+	for _, fileNo := range fileNos {
+		existing[fileNo] = true
+	}
+
+	for i := range app.Files {
+		f := &app.Files[i]
+		if existing[f.FileNo] {
+			err = t.completeLayoutFile(aid, f, keys)
+		} else {
+			err = t.createLayoutFile(aid, f, keys)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if ks.Marshal() != app.KeySettings.Marshal() {
+		err = t.ChangeKeySettings(app.KeySettings)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Authenticate with key 0 of the selected application aid as returned by
+// keys. If that fails because key 0 still is the default key, change all
+// keys from the default key to the keys returned by keys first. Keys a
+// previous, interrupted attempt changed already are skipped; they are
+// recognized by authenticating with the new key.
+func (t DESFireTag) setupKeys(aid DESFireAid, ks DESFireKeySettings, keys KeyProvider) error {
+	master, err := keys.Key(aid, 0)
+	if err != nil {
+		return err
+	}
+
+	if master == nil {
+		return fmt.Errorf("freefare: no master key for application %06x", aid.Aid())
+	}
+
+	err = t.Authenticate(0, *master)
+	if !isAuthenticationError(err) {
+		// authenticated (keys are set up) or something else is wrong
+		return err
+	}
+
+	def := defaultKey(ks.Crypto)
+	err = t.Authenticate(0, *def)
+	if err != nil {
+		return err
+	}
+
+	for keyNo := ks.MaxKeys - 1; keyNo > 0; keyNo-- {
+		key, err := keys.Key(aid, keyNo)
+		if err != nil {
+			return err
+		}
+
+		if key == nil {
+			return fmt.Errorf("freefare: no key %d for application %06x", keyNo, aid.Aid())
+		}
+
+		// authenticating with another key ends the authentication
+		// with the default key
+		err = t.Authenticate(keyNo, *key)
+		if err != nil && !isAuthenticationError(err) {
+			return err
+		}
+
+		changed := err == nil
+		err = t.Authenticate(0, *def)
+		if err != nil {
+			return err
+		}
+
+		if changed {
+			continue
+		}
+
+		err = t.ChangeKey(keyNo, *key, *def)
+		if err != nil {
+			return err
+		}
+	}
+
+	// changing the key we are authenticated with ends the authentication
+	err = t.ChangeKey(0, *master, *def)
+	if err != nil {
+		return err
+	}
+
+	return t.Authenticate(0, *master)
+}
+
+// Create the file described by f in the selected application aid and write
+// its initial data, if any, authenticating with the keys needed for writing
+// as returned by keys.
+func (t DESFireTag) createLayoutFile(aid DESFireAid, f *FileLayout, keys KeyProvider) error {
+	ft, err := f.FileType()
+	if err != nil {
+		return err
+	}
+
+	comm, err := f.CommMode()
+	if err != nil {
+		return err
+	}
+
+	switch ft {
+	case StandardDataFile, BackupDataFile:
+		isBackup := ft == BackupDataFile
+		err = t.CreateDataFile(f.FileNo, comm, f.AccessRights, f.Size, isBackup)
+		if err != nil || len(f.Data) == 0 {
+			return err
+		}
+
+		return t.writeLayoutData(aid, f, keys, isBackup)
+
+	case ValueFileWithBackup:
+		var limitedCredit byte
+		if f.LimitedCredit {
+			limitedCredit = 1
+		}
+
+		return t.CreateValueFile(f.FileNo, comm, f.AccessRights,
+			f.LowerLimit, f.UpperLimit, f.Value, limitedCredit)
+
+	default: // LinearRecordFileWithBackup or CyclicRecordFileWithBackup
+		return t.CreateRecordFile(f.FileNo, comm, f.AccessRights,
+			f.RecordSize, f.MaxRecords, ft == CyclicRecordFileWithBackup)
+	}
+}
+
+// Write the initial data of the data file described by f in the selected
+// application aid, authenticating with the keys needed for writing as
+// returned by keys.
+func (t DESFireTag) writeLayoutData(aid DESFireAid, f *FileLayout, keys KeyProvider, isBackup bool) error {
+	ar := f.AccessRights
+	return t.withFileAccess(aid, keys, []byte{ar.Write, ar.ReadWrite}, func() error {
+		df, err := t.OpenDataFile(f.FileNo)
+		if err != nil {
+			return err
+		}
+
+		_, err = df.WriteAt(f.Data, 0)
+		if err != nil || !isBackup {
+			return err
+		}
+
+		return t.CommitTransaction()
+	})
+}
+
+// Finish the existing file described by f in the selected application aid
+// in case a previous attempt to create it was interrupted: if it is a data
+// file of the type and size of f and reads as all zeroes where the initial
+// data of f goes, write the initial data. Files the tag does not let us read
+// are left alone.
+func (t DESFireTag) completeLayoutFile(aid DESFireAid, f *FileLayout, keys KeyProvider) error {
+	if len(f.Data) == 0 {
+		return nil
+	}
+
+	ft, err := f.FileType()
+	if err != nil {
+		return err
+	}
+
+	fs, err := t.FileSettings(f.FileNo)
+	switch {
+	case err == nil:
+	case err == Error(UnknownFileType):
+		return nil
+	default:
+		return err
+	}
+
+	if fs.FileType != ft || fs.FileSize != f.Size {
+		return nil
+	}
+
+	buf := make([]byte, len(f.Data))
+	ar := f.AccessRights
+	err = t.withFileAccess(aid, keys, []byte{ar.Read, ar.ReadWrite}, func() error {
+		df, err := t.OpenDataFile(f.FileNo)
+		if err != nil {
+			return err
+		}
+
+		_, err = df.ReadAt(buf, 0)
+		return err
+	})
+
+	switch {
+	case err == nil:
+	case isDenied(err):
+		return nil
+	default:
+		return err
+	}
+
+	for _, b := range buf {
+		if b != 0 {
+			return nil
+		}
+	}
+
+	return t.writeLayoutData(aid, f, keys, ft == BackupDataFile)
+}
+
+// Run op on the selected application aid, authenticated with key 0. If op is
+// denied access, authenticate with each of keyNos (skipping Free and Deny)
+// in turn and try again. If another key was used, authenticate with key 0
+// again afterwards.
+func (t DESFireTag) withFileAccess(aid DESFireAid, keys KeyProvider, keyNos []byte, op func() error) error {
+	err := op()
+	if !isDenied(err) {
+		return err
+	}
+
+	switched := false
+	for _, keyNo := range keyNos {
+		if keyNo == Free || keyNo == Deny || keyNo == 0 {
+			continue
+		}
+
+		key, kerr := keys.Key(aid, keyNo)
+		if kerr != nil {
+			return kerr
+		}
+
+		if key == nil {
+			continue
+		}
+
+		switched = true
+		err = t.Authenticate(keyNo, *key)
+		if err == nil {
+			err = op()
+		}
+
+		if !isDenied(err) {
+			break
+		}
+	}
+
+	if !switched {
+		return err
+	}
+
+	master, kerr := keys.Key(aid, 0)
+	if kerr != nil {
+		return kerr
+	}
+
+	if master != nil {
+		aerr := t.Authenticate(0, *master)
+		if err == nil {
+			err = aerr
+		}
+	}
+
+	return err
+}
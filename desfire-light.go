@@ -0,0 +1,235 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "encoding/binary"
+
+// Native command codes of DESFire Light tags in addition to the common EV2
+// commands.
+const (
+	cmdGetValueEV2                = 0x6c
+	cmdCreditEV2                  = 0x0c
+	cmdDebitEV2                   = 0xdc
+	cmdLimitedCreditEV2           = 0x1c
+	cmdReadRecordsEV2             = 0xab
+	cmdWriteRecordEV2             = 0x8b
+	cmdUpdateRecordEV2            = 0xba
+	cmdClearRecordFile            = 0xeb
+	cmdCommitTransaction          = 0xc7
+	cmdAbortTransaction           = 0xa7
+	cmdCommitReaderID             = 0xc8
+	cmdCreateTransactionMACFile   = 0xce
+	cmdDeleteTransactionMACFile   = 0xdf
+	lightVersionType              = 0x08
+	transactionMACKeyOptionAES    = 0x02
+	commitTransactionReturnTMAC   = 0x01
+	commitTransactionNoReturnTMAC = 0x00
+)
+
+// DF name of the application of DESFire Light tags.
+var lightDFName = []byte{
+	0xa0, 0x00, 0x00, 0x03, 0x96, 0x56, 0x43, 0x41,
+	0x03, 0xf0, 0x15, 0x40, 0x00, 0x00, 0x00, 0x0b,
+}
+
+// Convert a DESFireTag into a DESFireLightTag to access functionality
+// available for Mifare DESFire Light tags. These tags have a single, fixed
+// application with a fixed set of files (data, value, cyclic record, and
+// transaction MAC file), are accessed through ISO file selection and only
+// support EV2 or LRP secure messaging. As the libfreefare does not know
+// about these tags, all commands are implemented natively and require a
+// secure messaging session established with AuthenticateEV2First() or
+// AuthenticateLRPFirst() for anything but plain communication.
+//
+// The data, value, and record functions take the communication mode to use
+// as a parameter. It must match the communication mode of the file as
+// returned by FileSettings().
+type DESFireLightTag struct {
+	ev2Tag
+}
+
+// Check if t is a DESFire Light tag and return it as a DESFireLightTag. This
+// function calls Version() and thus must be called while connected, before
+// any secure messaging session is established. If t is not a DESFire Light
+// tag, an InvalidTagType error is returned.
+func (t DESFireTag) Light() (DESFireLightTag, error) {
+	vi, err := t.Version()
+	if err != nil {
+		return DESFireLightTag{}, err
+	}
+
+	if vi.Hardware.VendorID != nxpVendorID || vi.Hardware.Type != lightVersionType {
+		return DESFireLightTag{}, Error(InvalidTagType)
+	}
+
+	return DESFireLightTag{ev2Tag{t}}, nil
+}
+
+// Select the application of the tag using ISOSelectFile. This must be done
+// before authenticating with an application key. Selecting drops the secure
+// messaging session.
+func (t DESFireLightTag) SelectApplication() error {
+	return t.selectDFName(lightDFName)
+}
+
+// Read the value of value file fileNo.
+func (t DESFireLightTag) Value(fileNo byte, commMode byte) (int32, error) {
+	resp, err := t.Command(cmdGetValueEV2, []byte{fileNo}, nil, commMode)
+	if err != nil {
+		return -1, err
+	}
+
+	if len(resp) < 4 {
+		return -1, Error(LengthError)
+	}
+
+	return int32(binary.LittleEndian.Uint32(resp)), nil
+}
+
+// Send a Credit, Debit, or LimitedCredit command.
+func (t DESFireLightTag) changeValue(cmd, fileNo byte, amount int32, commMode byte) error {
+	var data [4]byte
+	binary.LittleEndian.PutUint32(data[:], uint32(amount))
+	_, err := t.Command(cmd, []byte{fileNo}, data[:], commMode)
+	return err
+}
+
+// Add amount to the value of the file fileNo. The change takes effect with
+// CommitTransaction().
+func (t DESFireLightTag) Credit(fileNo byte, amount int32, commMode byte) error {
+	return t.changeValue(cmdCreditEV2, fileNo, amount, commMode)
+}
+
+// Subtract amount from the value of the file fileNo. The change takes effect
+// with CommitTransaction().
+func (t DESFireLightTag) Debit(fileNo byte, amount int32, commMode byte) error {
+	return t.changeValue(cmdDebitEV2, fileNo, amount, commMode)
+}
+
+// Add a limited amount to the value of the file fileNo without full credit
+// permissions. The change takes effect with CommitTransaction().
+func (t DESFireLightTag) LimitedCredit(fileNo byte, amount int32, commMode byte) error {
+	return t.changeValue(cmdLimitedCreditEV2, fileNo, amount, commMode)
+}
+
+// Read count records starting at record recNo from the record file fileNo
+// and return them concatenated. Record 0 is the newest record; the records
+// are returned oldest first. If count is 0, all records from recNo on are
+// read.
+func (t DESFireLightTag) ReadRecords(fileNo byte, recNo, count uint32, commMode byte) ([]byte, error) {
+	header := append([]byte{fileNo}, uint24(recNo)...)
+	header = append(header, uint24(count)...)
+	return t.Command(cmdReadRecordsEV2, header, nil, commMode)
+}
+
+// Write data at offset offset into a new record of the record file fileNo.
+// The record is added with CommitTransaction().
+func (t DESFireLightTag) WriteRecord(fileNo byte, offset uint32, data []byte, commMode byte) error {
+	header := append([]byte{fileNo}, uint24(offset)...)
+	header = append(header, uint24(uint32(len(data)))...)
+	_, err := t.Command(cmdWriteRecordEV2, header, data, commMode)
+	return err
+}
+
+// Overwrite data at offset offset in the existing record recNo of the record
+// file fileNo. The change takes effect with CommitTransaction().
+func (t DESFireLightTag) UpdateRecord(fileNo byte, recNo, offset uint32, data []byte, commMode byte) error {
+	header := append([]byte{fileNo}, uint24(recNo)...)
+	header = append(header, uint24(offset)...)
+	header = append(header, uint24(uint32(len(data)))...)
+	_, err := t.Command(cmdUpdateRecordEV2, header, data, commMode)
+	return err
+}
+
+// Erase all records from the record file fileNo. The change takes effect with
+// CommitTransaction().
+func (t DESFireLightTag) ClearRecordFile(fileNo byte) error {
+	_, err := t.Command(cmdClearRecordFile, []byte{fileNo}, nil, t.macedIfAuthenticated())
+	return err
+}
+
+// The transaction MAC of a committed transaction: the transaction MAC
+// counter and the 8 byte transaction MAC value.
+type TransactionMAC struct {
+	Counter uint32
+	Value   []byte
+}
+
+// Validate pending changes to the tag. If returnTMAC is set, the tag must
+// have a transaction MAC file and the transaction MAC counter and value are
+// returned. Otherwise, the returned TransactionMAC is empty.
+func (t DESFireLightTag) CommitTransaction(returnTMAC bool) (TransactionMAC, error) {
+	option := byte(commitTransactionNoReturnTMAC)
+	if returnTMAC {
+		option = commitTransactionReturnTMAC
+	}
+
+	resp, err := t.Command(cmdCommitTransaction, []byte{option}, nil, t.macedIfAuthenticated())
+	if err != nil || !returnTMAC {
+		return TransactionMAC{}, err
+	}
+
+	if len(resp) < 12 {
+		return TransactionMAC{}, Error(LengthError)
+	}
+
+	return TransactionMAC{
+		Counter: binary.LittleEndian.Uint32(resp[0:4]),
+		Value:   resp[4:12],
+	}, nil
+}
+
+// Roll back pending changes to the tag.
+func (t DESFireLightTag) AbortTransaction() error {
+	_, err := t.Command(cmdAbortTransaction, nil, nil, t.macedIfAuthenticated())
+	return err
+}
+
+// Commit the 16 byte reader ID readerID into the ongoing transaction for
+// inclusion into the transaction MAC. The encrypted previous reader ID
+// (EncTMRI) is returned.
+func (t DESFireLightTag) CommitReaderID(readerID [16]byte) ([]byte, error) {
+	return t.Command(cmdCommitReaderID, nil, readerID[:], Maced)
+}
+
+// Create the transaction MAC file fileNo with the given communication
+// settings and access rights and the AES transaction MAC key key with key
+// version version. This requires authentication with the application master
+// key.
+func (t DESFireLightTag) CreateTransactionMACFile(
+	fileNo byte,
+	communicationSettings byte,
+	accessRights DESFireAccessRights,
+	key [16]byte,
+	version byte,
+) error {
+	ar := accessRights.Marshal()
+	header := []byte{
+		fileNo,
+		communicationSettings & fileOptionCommMode,
+		byte(ar), byte(ar >> 8),
+		transactionMACKeyOptionAES,
+	}
+
+	_, err := t.Command(cmdCreateTransactionMACFile, header, append(key[:], version), Enciphered)
+	return err
+}
+
+// Delete the transaction MAC file fileNo. This requires authentication with
+// the application master key.
+func (t DESFireLightTag) DeleteTransactionMACFile(fileNo byte) error {
+	_, err := t.Command(cmdDeleteTransactionMACFile, []byte{fileNo}, nil, Maced)
+	return err
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "crypto/subtle"
+
+import "github.com/clausecker/freefare/lrp"
+import "github.com/clausecker/freefare/sm"
+
+// AuthMode announced by the tag in the first response of an LRP
+// authentication.
+const lrpAuthMode = 0x01
+
+// LRP secure messaging. The framing is that of EV2 secure messaging, but
+// MACs are computed with CMAC-LRP and data is encrypted in LRICB mode using a
+// 32 bit encryption counter that runs through the whole session.
+type lrpSuite struct {
+	macKey, encKey *lrp.LRP
+	encCtr         [4]byte
+	master         []byte // session master key
+}
+
+func (l *lrpSuite) mac(msg []byte) []byte {
+	return l.macKey.CMAC(msg)
+}
+
+func (l *lrpSuite) evidence() (int, []byte) {
+	return sm.LRP, l.master
+}
+
+func (l *lrpSuite) encrypt(ti []byte, ctr uint16, data []byte) []byte {
+	out := make([]byte, len(data))
+	l.encKey.EncryptLRICB(l.encCtr[:], out, data)
+	return out
+}
+
+func (l *lrpSuite) decrypt(ti []byte, ctr uint16, data []byte) []byte {
+	out := make([]byte, len(data))
+	l.encKey.DecryptLRICB(l.encCtr[:], out, data)
+	return out
+}
+
+// Derive the LRP session keys from the key and the random numbers. The
+// session master key is the CMAC-LRP of the session vector (see
+// sm.LRPSessionKey()), MAC and encryption keys are its updated keys 0 and 1.
+func lrpSessionSuite(key [16]byte, rndA, rndB []byte) (*lrpSuite, error) {
+	master, err := sm.LRPSessionKey(key[:], rndA, rndB)
+	if err != nil {
+		return nil, err
+	}
+
+	macKey, err := lrp.New(master, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	encKey, err := lrp.New(master, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lrpSuite{macKey: macKey, encKey: encKey, master: master}, nil
+}
+
+// Perform the two pass LRP authentication with key using command cmd and
+// parameters param. Return the session keys, RndA, RndB, and the final
+// response with the PICCResponse MAC verified and removed.
+func (t DESFireTag) authenticateLRP(cmd byte, param []byte, key [16]byte) (suite *lrpSuite, rndA, rndB, resp []byte, err error) {
+	t.dropSession()
+
+	status, first, err := t.transceive(cmd, param)
+	if err != nil {
+		return
+	}
+
+	if status != AdditionalFrame {
+		err = Error(status)
+		return
+	}
+
+	// AuthMode || RndB, RndB is sent in plain
+	if len(first) != 17 {
+		err = Error(LengthError)
+		return
+	}
+
+	if first[0] != lrpAuthMode {
+		// the key is not configured for LRP
+		err = Error(AuthenticationError)
+		return
+	}
+
+	rndB = first[1:]
+	rndA = randomBytes(16)
+	suite, err = lrpSessionSuite(key, rndA, rndB)
+	if err != nil {
+		return
+	}
+
+	// RndA || PCDResponse, PCDResponse = MAC(RndA || RndB)
+	pcdResponse := suite.mac(append(append([]byte{}, rndA...), rndB...))
+	msg := append(append([]byte{}, rndA...), pcdResponse...)
+	status, second, err := t.transceive(AdditionalFrame, msg)
+	if err != nil {
+		return
+	}
+
+	if status != OperationOK {
+		err = Error(status)
+		return
+	}
+
+	// [PICCData] || PICCResponse
+	if len(second) < 16 {
+		err = Error(LengthError)
+		return
+	}
+
+	resp = second[:len(second)-16]
+	mac := append(append(append([]byte{}, rndB...), rndA...), resp...)
+	if subtle.ConstantTimeCompare(second[len(second)-16:], suite.mac(mac)) != 1 {
+		err = Error(AuthenticationError)
+	}
+
+	return
+}
+
+// Authenticate with the AES key keyNo using the LRP authentication protocol
+// (AuthenticateLRPFirst) and establish an LRP secure messaging session. This
+// requires the tag to be switched to LRP mode, see NTAG424Tag.EnableLRP().
+// Like the EV2 session established by AuthenticateEV2First(), the session
+// protects commands sent with Command() and the functions built on it. As
+// with AuthenticateEV2First(), a TagStateError is returned if t has no state
+// to keep the session in.
+func (t DESFireTag) AuthenticateLRPFirst(keyNo byte, key [16]byte) error {
+	if t.state == nil {
+		return Error(TagStateError)
+	}
+
+	// LenCap = 3, PCDCap2 = LRP
+	param := []byte{keyNo, 0x03, 0x02, 0x00, 0x00}
+	suite, rndA, rndB, resp, err := t.authenticateLRP(cmdAuthenticateEV2First, param, key)
+	if err != nil {
+		return err
+	}
+
+	// E(TI || PDCap2 || PCDCap2), consuming encryption counter 0
+	if len(resp) != 16 {
+		return Error(LengthError)
+	}
+
+	piccData := suite.decrypt(nil, 0, resp)
+
+	s := &ev2Session{keyNo: keyNo, suite: suite, rndA: rndA, rndB: rndB}
+	copy(s.ti[:], piccData[0:4])
+	t.state.ev2 = s
+	t.authenticated(AuthLRP, keyNo, MIFARE_KEY_AES128, nil)
+
+	return nil
+}
+
+// Authenticate with the AES key keyNo using AuthenticateLRPNonFirst. This
+// switches the keys of an existing LRP secure messaging session established
+// with AuthenticateLRPFirst(), keeping transaction identifier and command
+// counter and resetting the encryption counter. If there is no such session,
+// a TagStateError is returned.
+func (t DESFireTag) AuthenticateLRPNonFirst(keyNo byte, key [16]byte) error {
+	if t.state == nil || t.state.ev2 == nil {
+		return Error(TagStateError)
+	}
+
+	old := t.state.ev2
+	if _, ok := old.suite.(*lrpSuite); !ok {
+		return Error(TagStateError)
+	}
+
+	suite, rndA, rndB, resp, err := t.authenticateLRP(cmdAuthenticateEV2NonFirst, []byte{keyNo}, key)
+	if err != nil {
+		return err
+	}
+
+	if len(resp) != 0 {
+		return Error(LengthError)
+	}
+
+	t.state.ev2 = &ev2Session{
+		keyNo:  keyNo,
+		ti:     old.ti,
+		cmdCtr: old.cmdCtr,
+		suite:  suite,
+		rndA:   rndA,
+		rndB:   rndB,
+	}
+	t.authenticated(AuthLRP, keyNo, MIFARE_KEY_AES128, nil)
+
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+// DESFire tags allocate EEPROM in blocks of this many bytes.
+const desfireBlockSize = 32
+
+// EEPROM used by an application in addition to its keys and files: the
+// directory entry and the application settings. This is an estimate.
+const desfireApplicationOverhead = desfireBlockSize
+
+// Round n up to a multiple of the allocation block size.
+func desfireBlocks(n uint64) uint64 {
+	return (n + desfireBlockSize - 1) / desfireBlockSize * desfireBlockSize
+}
+
+// Number of bytes the tag stores per key of cryptography mode crypto,
+// including the key version.
+func desfireKeyStorage(crypto byte) uint64 {
+	switch crypto {
+	case Crypto3k3DES:
+		return 24 + 1
+	default: // DES, 2K3DES, and AES
+		return 16 + 1
+	}
+}
+
+// Predicted EEPROM usage of a CardLayout as computed by EstimateMemory().
+// All sizes are in bytes and multiples of the 32 byte allocation block size.
+type MemoryEstimate struct {
+	Total        uint64              `json:"total"`
+	Applications []ApplicationMemory `json:"applications"`
+}
+
+// Predicted EEPROM usage of one application: Keys covers the application
+// overhead and the keys, Files the sum of all files, Total both.
+type ApplicationMemory struct {
+	AID   uint32 `json:"aid"`
+	Keys  uint64 `json:"keys"`
+	Files uint64 `json:"files"`
+	Total uint64 `json:"total"`
+}
+
+// Predict the EEPROM usage of the applications and files of layout. Each
+// file is rounded up to the 32 byte allocation block size of the tag;
+// backup data files take twice their size and value files one block. The
+// numbers are estimates as NXP does not document the exact overhead; expect
+// the tag to differ by a few blocks.
+func EstimateMemory(layout *CardLayout) (*MemoryEstimate, error) {
+	err := layout.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	est := &MemoryEstimate{Applications: []ApplicationMemory{}}
+	for i := range layout.Applications {
+		app := &layout.Applications[i]
+		am := ApplicationMemory{AID: app.AID}
+		ks := app.KeySettings
+		am.Keys = desfireApplicationOverhead +
+			desfireBlocks(uint64(ks.MaxKeys)*desfireKeyStorage(ks.Crypto))
+
+		for j := range app.Files {
+			am.Files += app.Files[j].memory()
+		}
+
+		am.Total = am.Keys + am.Files
+		est.Total += am.Total
+		est.Applications = append(est.Applications, am)
+	}
+
+	return est, nil
+}
+
+// Predict the EEPROM usage of the file described by f. f must be valid.
+func (f *FileLayout) memory() uint64 {
+	ft, _ := f.FileType()
+	switch ft {
+	case StandardDataFile:
+		return desfireBlocks(uint64(f.Size))
+	case BackupDataFile:
+		return 2 * desfireBlocks(uint64(f.Size))
+	case ValueFileWithBackup:
+		return desfireBlockSize
+	default: // record files; the backup is one of the records
+		return desfireBlocks(uint64(f.RecordSize) * uint64(f.MaxRecords))
+	}
+}
+
+// Decode the StorageSize field of DESFireVersionInfo: the upper seven bits
+// n give the size as 2^n bytes. If the lowest bit is set, the size lies
+// between 2^n and 2^(n+1) bytes and exact is false.
+func decodeStorageSize(b byte) (size uint64, exact bool) {
+	return 1 << (b >> 1), b&1 == 0
+}
+
+// The result of CheckMemory(): the estimate for the layout compared to the
+// free memory of the tag and its total storage size.
+type MemoryCheck struct {
+	Estimate         *MemoryEstimate `json:"estimate"`
+	FreeMem          uint64          `json:"free_mem"`
+	StorageSize      uint64          `json:"storage_size"`
+	StorageSizeExact bool            `json:"storage_size_exact"`
+
+	// The layout fits into the free memory.
+	FitsFreeMem bool `json:"fits_free_mem"`
+
+	// The layout fits into the tag when blank. If the storage size is
+	// not exact, this compares against the lower bound.
+	FitsStorage bool `json:"fits_storage"`
+}
+
+// Estimate the memory needed by layout with EstimateMemory() and compare it
+// with FreeMem() and the storage size reported by Version(). The comparison
+// with FreeMem() assumes that nothing of layout exists on the tag yet.
+func (t DESFireTag) CheckMemory(layout *CardLayout) (*MemoryCheck, error) {
+	est, err := EstimateMemory(layout)
+	if err != nil {
+		return nil, err
+	}
+
+	free, err := t.FreeMem()
+	if err != nil {
+		return nil, err
+	}
+
+	vi, err := t.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	mc := &MemoryCheck{Estimate: est, FreeMem: uint64(free)}
+	mc.StorageSize, mc.StorageSizeExact = vi.StorageSize()
+	mc.FitsFreeMem = est.Total <= mc.FreeMem
+	mc.FitsStorage = est.Total <= mc.StorageSize
+	return mc, nil
+}
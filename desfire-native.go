@@ -0,0 +1,260 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+// Native DESFire commands not covered by the libfreefare. The libfreefare
+// only supports the DESFire EV1 command set and the EV1 secure messaging.
+// Newer features (EV2 secure messaging, LRP, and the tags derived from the
+// DESFire like NTAG 424 DNA and DESFire Light) are implemented here in Go by
+// talking to the tag directly through the nfc.Device, wrapping commands into
+// ISO 7816-4 APDUs just like the libfreefare does.
+//
+// Beware: the libfreefare does not see commands sent this way. If you
+// authenticated with Authenticate(), the libfreefare's view of the EV1 session
+// gets out of sync as soon as a native command is sent. Authenticate again
+// before using the libfreefare based functions after sending native commands.
+
+import "encoding/hex"
+
+import "github.com/clausecker/freefare/sm"
+
+// Maximum number of data bytes sent in one frame. Longer commands are split
+// into additional frames.
+const desfireFrameSize = 52
+
+// Maximum size of a response frame including status.
+const desfireMaxResponse = 256 + 2
+
+// An ISO 7816-4 status word other than 9000 returned by a tag in response
+// to an ISO command.
+type ISOError uint16
+
+// Get the error string of an ISOError
+func (e ISOError) Error() string {
+	sw := []byte{byte(e >> 8), byte(e)}
+	return "ISO 7816 status " + hex.EncodeToString(sw)
+}
+
+// Send one raw APDU to the tag and return the response data and status word.
+func (t DESFireTag) isoTransceive(apdu []byte) ([]byte, uint16, error) {
+	rx := make([]byte, desfireMaxResponse)
+	n, err := t.Device().InitiatorTransceiveBytes(apdu, rx, -1)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if n < 2 {
+		return nil, 0, Error(LengthError)
+	}
+
+	sw := uint16(rx[n-2])<<8 | uint16(rx[n-1])
+	return rx[:n-2], sw, nil
+}
+
+// Send one frame of a native command wrapped into an ISO 7816-4 APDU and
+// return the DESFire status code and the response data. An error is only
+// returned if the communication failed.
+func (t DESFireTag) transceive(cmd byte, data []byte) (byte, []byte, error) {
+	apdu := make([]byte, 0, 6+len(data))
+	apdu = append(apdu, 0x90, cmd, 0x00, 0x00)
+	if len(data) > 0 {
+		apdu = append(apdu, byte(len(data)))
+		apdu = append(apdu, data...)
+	}
+
+	apdu = append(apdu, 0x00)
+
+	resp, sw, err := t.isoTransceive(apdu)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if sw>>8 != 0x91 {
+		return 0, nil, ISOError(sw)
+	}
+
+	return byte(sw), resp, nil
+}
+
+// Send a native command, splitting data into multiple frames if needed and
+// collecting additional response frames. On success, the concatenated
+// response data and the final status (always OperationOK) are returned. If
+// the tag responds with any other status, it is returned as an Error.
+func (t DESFireTag) exchange(cmd byte, data []byte) ([]byte, error) {
+	return t.exchangeSplit(cmd, data, desfireFrameSize)
+}
+
+// Like exchange(), but send no more than first bytes of data in the first
+// frame. This is needed for commands like CreateDelegatedApplication that
+// expect the command data to be split at a fixed point.
+func (t DESFireTag) exchangeSplit(cmd byte, data []byte, first int) ([]byte, error) {
+	var resp []byte
+
+	size := first
+	for {
+		chunk := data
+		if len(chunk) > size {
+			chunk = chunk[:size]
+		}
+
+		data = data[len(chunk):]
+		size = desfireFrameSize
+
+		status, frame, err := t.transceive(cmd, chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		cmd = AdditionalFrame
+		switch {
+		case status == AdditionalFrame && len(data) > 0:
+			// tag wants the rest of the command
+			continue
+		case status == AdditionalFrame:
+			// tag has more response data
+			resp = append(resp, frame...)
+			continue
+		case status != OperationOK:
+			// the tag ends the authentication on error
+			t.dropSession()
+			return nil, Error(status)
+		case len(data) > 0:
+			// tag finished before all data was sent
+			return nil, Error(LengthError)
+		}
+
+		return append(resp, frame...), nil
+	}
+}
+
+// Send the native command cmd to the tag. header is sent in plain, data is
+// protected according to commMode (Plain, Maced, or Enciphered) and the
+// response data, with secure messaging removed, is returned. This function can
+// be used to issue commands the wrapper has no dedicated function for.
+//
+// If a secure messaging session was established using AuthenticateEV2First()
+// or AuthenticateLRPFirst(), EV2 or LRP secure messaging is applied to the
+// command. Otherwise, the command is sent as is and commMode must be Plain or
+// Default; an AuthenticationError is returned for the other modes. Default is
+// treated like Plain.
+//
+// If the tag responds with an error, the secure messaging session is dropped
+// as the tag does the same.
+func (t DESFireTag) Command(cmd byte, header, data []byte, commMode byte) ([]byte, error) {
+	return t.command(cmd, header, data, commMode, desfireFrameSize)
+}
+
+// Implementation of Command(). No more than first bytes of the command are
+// sent in the first frame, see exchangeSplit().
+func (t DESFireTag) command(cmd byte, header, data []byte, commMode byte, first int) ([]byte, error) {
+	var s *ev2Session
+	if t.state != nil {
+		s = t.state.ev2
+	}
+
+	if commMode == Default {
+		commMode = Plain
+	}
+
+	if t.state != nil {
+		t.state.last = nil
+	}
+
+	if s == nil {
+		if commMode != Plain {
+			return nil, Error(AuthenticationError)
+		}
+
+		return t.exchangeSplit(cmd, append(append([]byte{}, header...), data...), first)
+	}
+
+	resp, err := t.exchangeSplit(cmd, s.wrap(cmd, header, data, commMode), first)
+	if err != nil {
+		t.dropSession()
+		return nil, err
+	}
+
+	raw := resp
+	resp, err = s.unwrap(resp, commMode)
+	if err != nil {
+		t.dropSession()
+		return nil, err
+	}
+
+	if commMode == Maced {
+		protocol, macKey := s.suite.evidence()
+		t.state.last = &sm.Response{
+			Protocol: protocol,
+			MACKey:   macKey,
+			RndA:     s.rndA,
+			RndB:     s.rndB,
+			TI:       s.ti,
+			Counter:  s.cmdCtr, // advanced by unwrap()
+			Status:   OperationOK,
+			Data:     raw,
+		}
+	}
+
+	return resp, nil
+}
+
+// Return the raw response to the last command sent with Command() (or a
+// function built on it, like the data functions of NTAG424Tag and
+// DESFireLightTag) in Maced mode through an EV2 or LRP secure messaging
+// session, together with the session key material and random numbers needed
+// to verify its MAC offline with package sm. Responses in Enciphered mode are
+// not captured as their MAC is computed over the ciphertext, which proves
+// nothing about the plaintext without the session encryption key. If the last
+// command failed or was not sent in Maced mode, ok is false.
+//
+// Responses of the libfreefare based functions like ReadData() cannot be
+// captured as the libfreefare verifies and strips the MAC internally and does
+// not export the session key of EV1 and legacy sessions. To archive such
+// responses, capture them by other means and verify them with the EV1 and
+// legacy verifiers of package sm, supplying the session key yourself.
+func (t DESFireTag) LastResponse() (r sm.Response, ok bool) {
+	if t.state == nil || t.state.last == nil {
+		return sm.Response{}, false
+	}
+
+	return *t.state.last, true
+}
+
+// Send an ISO 7816-4 command with the given class, instruction, parameters,
+// command data and expected response length (0 for none, 256 for any) and
+// return the response data. No secure messaging is applied. A status word
+// other than 9000 is returned as an ISOError.
+func (t DESFireTag) isoCommand(cla, ins, p1, p2 byte, data []byte, le int) ([]byte, error) {
+	apdu := []byte{cla, ins, p1, p2}
+	if len(data) > 0 {
+		apdu = append(apdu, byte(len(data)))
+		apdu = append(apdu, data...)
+	}
+
+	if le > 0 {
+		apdu = append(apdu, byte(le))
+	}
+
+	resp, sw, err := t.isoTransceive(apdu)
+	if err != nil {
+		return nil, err
+	}
+
+	if sw != 0x9000 {
+		return nil, ISOError(sw)
+	}
+
+	return resp, nil
+}
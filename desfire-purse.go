@@ -0,0 +1,193 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "encoding/binary"
+
+// Kinds of purse log entries as found in PurseEntry.Kind
+const (
+	PurseTopUp  = 'T'
+	PurseSpend  = 'S'
+	PurseRefund = 'R'
+)
+
+// Size of the fixed part of a purse log entry: kind, amount, and balance.
+const purseEntryHeader = 1 + 4 + 4
+
+// A stored value purse made of a value file holding the balance and a record
+// file logging each operation on the purse, created with OpenPurse(). Every
+// operation changes the value file and appends a log entry in a single
+// transaction, so either both or neither take effect.
+//
+// Each log record holds the kind of operation (1 byte), the amount and the
+// resulting balance (4 bytes each, little endian), and application supplied
+// meta data filling the rest of the record. The record size of the log file
+// must thus be at least 9 bytes.
+type DESFirePurse struct {
+	t         DESFireTag
+	valueFile byte
+	log       *DESFireRecordFile
+}
+
+// A decoded purse log entry.
+type PurseEntry struct {
+	Kind    byte  // PurseTopUp, PurseSpend, or PurseRefund
+	Amount  int32 // amount of the operation
+	Balance int32 // balance after the operation
+	Meta    []byte
+}
+
+// Open a purse made of value file valueFile and the record file logFile of
+// the selected application. The log file should be a cyclic record file so
+// the oldest entries are overwritten once it is full.
+func (t DESFireTag) OpenPurse(valueFile, logFile byte) (*DESFirePurse, error) {
+	fs, err := t.FileSettings(valueFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.FileType != ValueFileWithBackup {
+		return nil, Error(ParameterError)
+	}
+
+	log, err := t.OpenRecordFile(logFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if log.RecordSize() < purseEntryHeader {
+		return nil, Error(LengthError)
+	}
+
+	return &DESFirePurse{t, valueFile, log}, nil
+}
+
+// Return the current balance of the purse.
+func (p *DESFirePurse) Balance() (int32, error) {
+	return p.t.Value(p.valueFile)
+}
+
+// Add amount to the balance of the purse and log the operation with meta.
+// A BoundaryError is returned if the balance would exceed the upper limit of
+// the value file.
+func (p *DESFirePurse) TopUp(amount int32, meta []byte) error {
+	return p.update(PurseTopUp, amount, meta)
+}
+
+// Subtract amount from the balance of the purse and log the operation with
+// meta. A BoundaryError is returned if the balance would fall below the lower
+// limit of the value file.
+func (p *DESFirePurse) Spend(amount int32, meta []byte) error {
+	return p.update(PurseSpend, amount, meta)
+}
+
+// Refund amount of the last Spend() with a limited credit operation and log
+// the operation with meta. This requires limited credit to be enabled on the
+// value file and amount must not exceed the amount spent in the last
+// transaction. Refund is meant for points of sale that have only debit
+// permission.
+func (p *DESFirePurse) Refund(amount int32, meta []byte) error {
+	return p.update(PurseRefund, amount, meta)
+}
+
+// Return the n most recent log entries in chronological order.
+func (p *DESFirePurse) Log(n int) ([]PurseEntry, error) {
+	records, err := p.log.Latest(n)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]PurseEntry, len(records))
+	for i, rec := range records {
+		entries[i] = PurseEntry{
+			Kind:    rec[0],
+			Amount:  int32(binary.LittleEndian.Uint32(rec[1:5])),
+			Balance: int32(binary.LittleEndian.Uint32(rec[5:9])),
+			Meta:    rec[purseEntryHeader:],
+		}
+	}
+
+	return entries, nil
+}
+
+// Perform an operation of the given kind, checking the limits of the value
+// file beforehand.
+func (p *DESFirePurse) update(kind byte, amount int32, meta []byte) error {
+	if amount <= 0 {
+		return Error(ParameterError)
+	}
+
+	if len(meta) > p.log.RecordSize()-purseEntryHeader {
+		return Error(LengthError)
+	}
+
+	fs, err := p.t.FileSettings(p.valueFile)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.t.Transaction(func(tx *DESFireTransaction) error {
+		balance, err := tx.Value(p.valueFile)
+		if err != nil {
+			return err
+		}
+
+		// check the limits ourselves to fail before anything is
+		// written. The tag checks them again on commit.
+		switch kind {
+		case PurseTopUp:
+			if int64(balance)+int64(amount) > int64(fs.UpperLimit) {
+				return Error(BoundaryError)
+			}
+
+			balance += amount
+			err = tx.Credit(p.valueFile, amount)
+
+		case PurseSpend:
+			if int64(balance)-int64(amount) < int64(fs.LowerLimit) {
+				return Error(BoundaryError)
+			}
+
+			balance -= amount
+			err = tx.Debit(p.valueFile, amount)
+
+		case PurseRefund:
+			if fs.LimitedCreditEnabled&1 == 0 {
+				return Error(PermissionError)
+			}
+
+			if amount > fs.LimitedCreditValue {
+				return Error(BoundaryError)
+			}
+
+			balance += amount
+			err = tx.LimitedCredit(p.valueFile, amount)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		rec := make([]byte, purseEntryHeader, p.log.RecordSize())
+		rec[0] = kind
+		binary.LittleEndian.PutUint32(rec[1:5], uint32(amount))
+		binary.LittleEndian.PutUint32(rec[5:9], uint32(balance))
+		rec = append(rec, meta...)
+
+		return p.log.Append(rec)
+	})
+
+	return err
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+// A linear or cyclic record file of a DESFire tag opened with
+// OpenRecordFile(). A DESFireRecordFile operates on whole records instead of
+// byte offsets. Records are indexed in chronological order: record 0 is the
+// oldest record still stored in the file. Append() and Clear() commit the
+// transaction themselves, so the changes take effect immediately, unless
+// they are called from within Transaction(), in which case the changes are
+// committed together with the rest of the transaction.
+type DESFireRecordFile struct {
+	t          DESFireTag
+	fileNo     byte
+	recordSize int
+	maxRecords int
+	cyclic     bool
+}
+
+// Open the linear or cyclic record file fileNo of the selected application.
+// Record size and capacity are taken from FileSettings().
+func (t DESFireTag) OpenRecordFile(fileNo byte) (*DESFireRecordFile, error) {
+	fs, err := t.FileSettings(fileNo)
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.FileType != LinearRecordFileWithBackup &&
+		fs.FileType != CyclicRecordFileWithBackup {
+		return nil, Error(ParameterError)
+	}
+
+	return &DESFireRecordFile{
+		t:          t,
+		fileNo:     fileNo,
+		recordSize: int(fs.RecordSize),
+		maxRecords: int(fs.MaxNumberOfRecords),
+		cyclic:     fs.FileType == CyclicRecordFileWithBackup,
+	}, nil
+}
+
+// Return the size of each record in bytes.
+func (f *DESFireRecordFile) RecordSize() int {
+	return f.recordSize
+}
+
+// Return the maximum number of records the file can hold. Note that a cyclic
+// record file holds one record less than this as one record is reserved for
+// the transaction mechanism.
+func (f *DESFireRecordFile) MaxRecords() int {
+	return f.maxRecords
+}
+
+// Report if the file is a cyclic record file. Once a cyclic record file is
+// full, appending a record overwrites the oldest one. Appending to a full
+// linear record file fails.
+func (f *DESFireRecordFile) Cyclic() bool {
+	return f.cyclic
+}
+
+// Return the number of records currently stored in the file. This function
+// calls FileSettings() as the number of records changes over time.
+func (f *DESFireRecordFile) Len() (int, error) {
+	fs, err := f.t.FileSettings(f.fileNo)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(fs.CurrentNumberOfRecords), nil
+}
+
+// Append record to the file and commit the transaction (see above). If
+// record is shorter than the record size, the rest of the record is filled
+// with zeroes. A record longer than the record size causes a LengthError.
+func (f *DESFireRecordFile) Append(record []byte) error {
+	if len(record) > f.recordSize {
+		return Error(LengthError)
+	}
+
+	buf := make([]byte, f.recordSize)
+	copy(buf, record)
+	n, err := f.t.WriteRecord(f.fileNo, 0, buf)
+	if err != nil {
+		return err
+	}
+
+	if n != len(buf) {
+		return Error(LengthError)
+	}
+
+	return f.t.autoCommit()
+}
+
+// Read n records starting with record from in chronological order, record 0
+// being the oldest record in the file. Asking for records that do not exist
+// causes a BoundaryError.
+func (f *DESFireRecordFile) Records(from, n int) ([][]byte, error) {
+	if from < 0 || n < 0 {
+		return nil, Error(ParameterError)
+	}
+
+	if n == 0 {
+		return [][]byte{}, nil
+	}
+
+	count, err := f.Len()
+	if err != nil {
+		return nil, err
+	}
+
+	if from+n > count {
+		return nil, Error(BoundaryError)
+	}
+
+	// convert chronological index into record offset of the most recent
+	// record to read
+	return f.t.readRecordRange(f.fileNo, count-from-n, n, f.recordSize)
+}
+
+// Read the n most recent records in chronological order. If the file holds
+// fewer than n records, all records are returned. This is the usual way to
+// inspect a cyclic record file used as a log.
+func (f *DESFireRecordFile) Latest(n int) ([][]byte, error) {
+	if n < 0 {
+		return nil, Error(ParameterError)
+	}
+
+	count, err := f.Len()
+	if err != nil {
+		return nil, err
+	}
+
+	if n > count {
+		n = count
+	}
+
+	if n == 0 {
+		return [][]byte{}, nil
+	}
+
+	return f.t.readRecordRange(f.fileNo, 0, n, f.recordSize)
+}
+
+// Erase all records from the file and commit the transaction (see above).
+func (f *DESFireRecordFile) Clear() error {
+	err := f.t.ClearRecordFile(f.fileNo)
+	if err != nil {
+		return err
+	}
+
+	return f.t.autoCommit()
+}
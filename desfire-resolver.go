@@ -0,0 +1,97 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "strings"
+
+// Resolves the stable identity of DESFire tags that may be configured to
+// answer with a random UID (see PICCConfiguration). For tags with a random
+// UID, the resolver selects application AID, authenticates with key KeyNo
+// as returned by Keys, and retrieves the real UID with CardUID(). For all
+// other tags, the UID is returned as is without authentication.
+//
+// The real UID is only handed out after the tag has authenticated. It is
+// remembered with the tag until the next Connect() or Disconnect(), so
+// resolving the same tag again during one connection does not authenticate
+// again. Nothing is remembered across connections as a random UID does not
+// identify a tag: another tag may answer with the same one.
+type UIDResolver struct {
+	AID   DESFireAid
+	KeyNo byte
+	Keys  KeyProvider
+}
+
+// Create a resolver authenticating with key keyNo of application aid as
+// returned by keys.
+func NewUIDResolver(aid DESFireAid, keyNo byte, keys KeyProvider) *UIDResolver {
+	return &UIDResolver{AID: aid, KeyNo: keyNo, Keys: keys}
+}
+
+// Report if uid, as returned by UID(), is a random UID. Random UIDs are 4
+// bytes long and start with 08h (ISO/IEC 14443-3).
+func IsRandomUID(uid string) bool {
+	return len(uid) == 8 && strings.HasPrefix(uid, "08")
+}
+
+// Return the stable UID of t in the same format as UID(). This leaves the
+// application AID selected and authenticated for tags with a random UID
+// unless the real UID was already resolved during this connection.
+func (r *UIDResolver) Resolve(t DESFireTag) (string, error) {
+	uid := t.UID()
+	if !IsRandomUID(uid) {
+		return uid, nil
+	}
+
+	if t.state != nil && t.state.cardUID != "" {
+		return t.state.cardUID, nil
+	}
+
+	err := t.SelectApplication(r.AID)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := r.Keys.Key(r.AID, r.KeyNo)
+	if err != nil {
+		return "", err
+	}
+
+	if key == nil {
+		return "", Error(AuthenticationError)
+	}
+
+	err = t.Authenticate(r.KeyNo, *key)
+	if err != nil {
+		return "", err
+	}
+
+	cardUID, err := t.CardUID()
+	if err != nil {
+		return "", err
+	}
+
+	if t.state != nil {
+		t.state.cardUID = cardUID
+	}
+
+	return cardUID, nil
+}
+
+// Forget the real UID remembered by UIDResolver.Resolve().
+func (t DESFireTag) forgetCardUID() {
+	if t.state != nil {
+		t.state.cardUID = ""
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "fmt"
+
+// Select application aid (0 for the PICC) and change all its keys from the
+// keys given by oldKeys to the keys given by newKeys. The key version of
+// each new key must differ from the version of the corresponding old key;
+// the current version of each key as reported by KeyVersion() tells which
+// of the two keys is live. This makes RotateKeys() resumable: if the card
+// leaves the field half way through, calling RotateKeys() again with the
+// same parameters picks up where the previous call stopped.
+//
+// Keys are changed in an order that never locks out the keys still needed:
+// first the keys changed with the change key given by the key settings,
+// then the change key itself and keys changed with themselves, and the
+// master key last. Each change is confirmed with KeyVersion(). If a key
+// version matches neither the old nor the new key, RotateKeys() stops with
+// an error instead of guessing.
+func (t DESFireTag) RotateKeys(aid DESFireAid, oldKeys, newKeys KeyProvider) error {
+	err := t.SelectApplication(aid)
+	if err != nil {
+		return err
+	}
+
+	ks, err := t.KeySettings()
+	if err != nil {
+		return err
+	}
+
+	r := keyRotation{t: t, aid: aid, settings: ks, authKey: -1}
+	n := int(ks.MaxKeys)
+	if aid.Aid() == 0 {
+		// only the PICC master key can be changed
+		n = 1
+	}
+
+	r.oldKeys = make([]*DESFireKey, n)
+	r.newKeys = make([]*DESFireKey, n)
+	r.rotated = make([]bool, n)
+	for keyNo := 0; keyNo < n; keyNo++ {
+		err = r.load(byte(keyNo), oldKeys, newKeys)
+		if err != nil {
+			return err
+		}
+	}
+
+	// keys changed by another key, then keys changed by themselves,
+	// then the master key
+	var order []byte
+	for keyNo := 1; keyNo < n; keyNo++ {
+		if r.changer(byte(keyNo)) != byte(keyNo) {
+			order = append(order, byte(keyNo))
+		}
+	}
+
+	for keyNo := 1; keyNo < n; keyNo++ {
+		if r.changer(byte(keyNo)) == byte(keyNo) {
+			order = append(order, byte(keyNo))
+		}
+	}
+
+	order = append(order, 0)
+
+	for _, keyNo := range order {
+		if r.rotated[keyNo] {
+			continue
+		}
+
+		err = r.change(keyNo)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// State of a key rotation in progress
+type keyRotation struct {
+	t                DESFireTag
+	aid              DESFireAid
+	settings         DESFireKeySettings
+	oldKeys, newKeys []*DESFireKey
+	rotated          []bool // key already changed to new key
+
+	// key we are authenticated with, -1 if none
+	authKey int
+}
+
+// Obtain old and new key keyNo and find out which one is live.
+func (r *keyRotation) load(keyNo byte, oldKeys, newKeys KeyProvider) error {
+	oldKey, err := oldKeys.Key(r.aid, keyNo)
+	if err != nil {
+		return err
+	}
+
+	newKey, err := newKeys.Key(r.aid, keyNo)
+	if err != nil {
+		return err
+	}
+
+	if oldKey == nil || newKey == nil {
+		return fmt.Errorf("freefare: missing key %d of application %06x", keyNo, r.aid.Aid())
+	}
+
+	if oldKey.Version() == newKey.Version() {
+		return fmt.Errorf("freefare: old and new key %d of application %06x have the same version %d",
+			keyNo, r.aid.Aid(), newKey.Version())
+	}
+
+	version, err := r.t.KeyVersion(keyNo)
+	if err != nil {
+		return err
+	}
+
+	switch version {
+	case oldKey.Version():
+		r.rotated[keyNo] = false
+	case newKey.Version():
+		r.rotated[keyNo] = true
+	default:
+		return fmt.Errorf("freefare: key %d of application %06x has unexpected version %d",
+			keyNo, r.aid.Aid(), version)
+	}
+
+	r.oldKeys[keyNo] = oldKey
+	r.newKeys[keyNo] = newKey
+	return nil
+}
+
+// Return the number of the key needed to change key keyNo.
+func (r *keyRotation) changer(keyNo byte) byte {
+	if keyNo == 0 || r.settings.ChangeKey == ChangeKeySameKey {
+		return keyNo
+	}
+
+	return r.settings.ChangeKey
+}
+
+// Return the live value of key keyNo.
+func (r *keyRotation) live(keyNo byte) *DESFireKey {
+	if r.rotated[keyNo] {
+		return r.newKeys[keyNo]
+	}
+
+	return r.oldKeys[keyNo]
+}
+
+// Change key keyNo from its old to its new value and confirm the change.
+func (r *keyRotation) change(keyNo byte) error {
+	changer := r.changer(keyNo)
+	if keyNo != 0 && r.settings.ChangeKey == ChangeKeyFrozen {
+		return Error(PermissionError)
+	}
+
+	if int(changer) >= len(r.oldKeys) {
+		return fmt.Errorf("freefare: change key %d of application %06x does not exist", changer, r.aid.Aid())
+	}
+
+	if r.authKey != int(changer) {
+		err := r.t.Authenticate(changer, *r.live(changer))
+		if err != nil {
+			return err
+		}
+
+		r.authKey = int(changer)
+	}
+
+	err := r.t.ChangeKey(keyNo, *r.newKeys[keyNo], *r.oldKeys[keyNo])
+	if err != nil {
+		return err
+	}
+
+	if changer == keyNo {
+		// changing the key we are authenticated with ends the
+		// authentication
+		r.authKey = -1
+	}
+
+	version, err := r.t.KeyVersion(keyNo)
+	if err != nil {
+		return err
+	}
+
+	if version != r.newKeys[keyNo].Version() {
+		return fmt.Errorf("freefare: key %d of application %06x has version %d after change, expected %d",
+			keyNo, r.aid.Aid(), version, r.newKeys[keyNo].Version())
+	}
+
+	r.rotated[keyNo] = true
+	return nil
+}
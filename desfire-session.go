@@ -0,0 +1,138 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+// #include <freefare.h>
+import "C"
+import "syscall"
+
+// Authentication protocols as found in DESFireSession.Protocol
+const (
+	AuthNone   = iota // not authenticated
+	AuthLegacy        // Authenticate(), implemented by the libfreefare
+	AuthEV2           // AuthenticateEV2First() or AuthenticateEV2NonFirst()
+	AuthLRP           // AuthenticateLRPFirst() or AuthenticateLRPNonFirst()
+)
+
+// What the wrapper knows about the state of a DESFire tag: the selected
+// application and the key authenticated with. The wrapper updates this
+// information as commands are sent through it. It assumes the worst when
+// in doubt: a failed selection leaves the selected application unknown and
+// an error returned by the tag ends the authentication, as the tag does
+// the same. The session is not updated by commands sent to the tag behind
+// the wrapper's back, e.g. by C code using Pointer().
+type DESFireSession struct {
+	// Selected is set if application AID is known to be selected.
+	Selected bool
+	AID      DESFireAid
+
+	// Protocol is the authentication protocol used or AuthNone if not
+	// authenticated. KeyNo and KeyType describe the key authenticated
+	// with; EV2 and LRP authentication always use AES keys.
+	Protocol int
+	KeyNo    byte
+	KeyType  MifareKeyType
+
+	// libfreefare key used for legacy authentication, see
+	// EnsureAuthenticated(). keyRef keeps it from being freed (and its
+	// address reused) while the session refers to it.
+	key    C.MifareDESFireKey
+	keyRef *finalizee
+}
+
+// Return what the wrapper knows about the selected application and the
+// authentication state of t.
+func (t DESFireTag) Session() DESFireSession {
+	if t.state == nil {
+		return DESFireSession{}
+	}
+
+	return t.state.session
+}
+
+// Select application aid unless Session() says it is selected already.
+// Note that selecting an application ends the authentication, so this
+// function is useful to avoid needless authentications, too.
+func (t DESFireTag) EnsureSelected(aid DESFireAid) error {
+	if t.state != nil && t.state.session.Selected && t.state.session.AID == aid {
+		return nil
+	}
+
+	return t.SelectApplication(aid)
+}
+
+// Authenticate with key keyNo unless Session() says the tag is already
+// authenticated with the same key number through Authenticate() using the
+// same key. Keys are compared by the libfreefare key they wrap, not by value:
+// a DESFireKey and its copies are the same key, but two keys created from the
+// same bytes are not. So keep the key returned by NewDESFireAESKey() and
+// friends around and pass it each time to benefit from this function.
+func (t DESFireTag) EnsureAuthenticated(keyNo byte, key DESFireKey) error {
+	if t.state != nil {
+		s := &t.state.session
+		if s.Protocol == AuthLegacy && s.KeyNo == keyNo && s.key != nil && s.key == key.key {
+			return nil
+		}
+	}
+
+	return t.Authenticate(keyNo, key)
+}
+
+// Record that application aid has been selected. The authentication is
+// ended by selecting, see dropSession().
+func (t DESFireTag) selected(aid DESFireAid) {
+	if t.state != nil {
+		t.state.session.Selected = true
+		t.state.session.AID = aid
+	}
+}
+
+// Record that the selected application is unknown.
+func (t DESFireTag) unselected() {
+	if t.state != nil {
+		t.state.session.Selected = false
+		t.state.session.AID = DESFireAid{}
+	}
+}
+
+// Record a successful authentication with key keyNo of type keyType using
+// protocol. key is the key used for legacy authentication or nil.
+func (t DESFireTag) authenticated(protocol int, keyNo byte, keyType MifareKeyType, key *DESFireKey) {
+	if t.state != nil {
+		s := &t.state.session
+		s.Protocol = protocol
+		s.KeyNo = keyNo
+		s.KeyType = keyType
+		s.key = nil
+		s.keyRef = nil
+		if key != nil {
+			s.key = key.key
+			s.keyRef = key.finalizee
+		}
+	}
+}
+
+// Translate errno value into Go error like tag.TranslateError(). As the tag
+// ends the authentication when it responds with an error, errors that could
+// come from the tag (as opposed to parameter checks in the libfreefare) end
+// the session tracked by the wrapper, too.
+func (t DESFireTag) TranslateError(e error) error {
+	switch e {
+	case syscall.EIO, syscall.EPERM, syscall.EACCES:
+		t.dropSession()
+	}
+
+	return t.tag.TranslateError(e)
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+// A transaction in progress as passed to the body of Transaction(). The
+// embedded DESFireTag is the tag the transaction runs on; all changes made
+// through it (or through any other copy of the tag) become part of the
+// transaction.
+type DESFireTransaction struct {
+	DESFireTag
+	touched []byte
+}
+
+// Return the numbers of the files changed in the transaction so far in the
+// order they were first changed.
+func (tx *DESFireTransaction) Touched() []byte {
+	return append([]byte{}, tx.touched...)
+}
+
+// Run body as a transaction on the backup data, value, and record files of
+// the selected application. If body returns nil, the transaction is
+// committed with CommitTransaction() unless body did not change any file.
+// As the tag answers NoChanges if there was nothing to commit (e.g. if only
+// standard data files were changed), that is not treated as an error. If
+// body returns an error or panics, the transaction is rolled back with
+// AbortTransaction() and the error or panic is passed on. This makes changes
+// to multiple files (e.g. debiting a value file and appending a log record)
+// all or nothing.
+//
+// The numbers of the files changed by body are returned in the order they
+// were first changed, regardless of whether the transaction was committed.
+//
+// If Transaction() is called from within the body of another transaction,
+// body becomes part of the outer transaction and is neither committed nor
+// aborted on its own. Changes to standard data files are not covered by the
+// transaction mechanism of the tag and take effect immediately.
+func (t DESFireTag) Transaction(body func(tx *DESFireTransaction) error) (touched []byte, err error) {
+	if t.state == nil {
+		return nil, Error(TagStateError)
+	}
+
+	// nested transaction: join the outer one
+	if outer := t.state.tx; outer != nil {
+		before := len(outer.touched)
+		err = body(outer)
+		return append([]byte{}, outer.touched[before:]...), err
+	}
+
+	tx := &DESFireTransaction{DESFireTag: t}
+	t.state.tx = tx
+	committed := false
+	defer func() {
+		t.state.tx = nil
+		touched = tx.Touched()
+		if !committed {
+			// keep the original error or panic
+			t.AbortTransaction()
+		}
+	}()
+
+	err = body(tx)
+	if err != nil {
+		return
+	}
+
+	if len(tx.touched) == 0 {
+		committed = true
+		return
+	}
+
+	err = t.CommitTransaction()
+	if err == Error(NoChanges) {
+		err = nil
+	}
+
+	committed = err == nil
+	return
+}
+
+// Record that file fileNo is changed if a transaction is in progress.
+func (t DESFireTag) touch(fileNo byte) {
+	if t.state == nil || t.state.tx == nil {
+		return
+	}
+
+	tx := t.state.tx
+	for _, f := range tx.touched {
+		if f == fileNo {
+			return
+		}
+	}
+
+	tx.touched = append(tx.touched, fileNo)
+}
+
+// Commit the transaction unless a transaction run by Transaction() is in
+// progress, in which case it will be committed at the end of the transaction.
+func (t DESFireTag) autoCommit() error {
+	if t.state != nil && t.state.tx != nil {
+		return nil
+	}
+
+	return t.CommitTransaction()
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+import "fmt"
+import "time"
+
+// Hardware types found in DESFireVersionInfo.Hardware.Type
+const (
+	desfireVersionType        = 0x01
+	desfireSmartMXVersionType = 0x81
+)
+
+// Names of IC manufacturers by their ISO/IEC 7816-6 code as found in
+// DESFireVersionInfo.Hardware.VendorID.
+var vendorNames = map[byte]string{
+	0x01: "Motorola",
+	0x02: "STMicroelectronics",
+	0x03: "Hitachi",
+	0x04: "NXP Semiconductors",
+	0x05: "Infineon Technologies",
+	0x06: "Cylink",
+	0x07: "Texas Instruments",
+	0x08: "Fujitsu",
+	0x09: "Matsushita",
+	0x0a: "NEC",
+	0x0b: "Oki Electric",
+	0x0c: "Toshiba",
+	0x0d: "Mitsubishi Electric",
+	0x0e: "Samsung Electronics",
+	0x0f: "Hynix",
+}
+
+// Names of the DESFire generations by major hardware version.
+var desfireGenerations = map[byte]string{
+	0x00: "MIFARE DESFire",
+	0x01: "MIFARE DESFire EV1",
+	0x12: "MIFARE DESFire EV2",
+	0x22: "MIFARE DESFire EV2 XL",
+	0x30: "MIFARE DESFire EV3",
+	0x33: "MIFARE DESFire EV3",
+}
+
+// Return the name of the manufacturer of the tag, e.g. "NXP Semiconductors".
+func (vi DESFireVersionInfo) VendorName() string {
+	name, ok := vendorNames[vi.Hardware.VendorID]
+	if !ok {
+		return fmt.Sprintf("unknown vendor %#02x", vi.Hardware.VendorID)
+	}
+
+	return name
+}
+
+// Return the product name of the tag as determined from the hardware
+// information, e.g. "MIFARE DESFire EV2", "MIFARE DESFire Light", or
+// "NTAG 424 DNA".
+func (vi DESFireVersionInfo) ProductName() string {
+	hw := vi.Hardware
+	if hw.VendorID == nxpVendorID {
+		switch hw.Type {
+		case desfireVersionType:
+			if name, ok := desfireGenerations[hw.VersionMajor]; ok {
+				return name
+			}
+
+		case desfireSmartMXVersionType:
+			return "MIFARE DESFire on SmartMX"
+
+		case lightVersionType:
+			return "MIFARE DESFire Light"
+
+		case ntag424VersionType:
+			return "NTAG 424 DNA"
+		}
+	}
+
+	return fmt.Sprintf("unknown product (vendor %#02x, type %#02x, version %d.%d)",
+		hw.VendorID, hw.Type, hw.VersionMajor, hw.VersionMinor)
+}
+
+// Return the EEPROM size of the tag in bytes. The tag encodes the size as a
+// power of two; if exact is false, the size lies between size and 2*size
+// bytes.
+func (vi DESFireVersionInfo) StorageSize() (size uint64, exact bool) {
+	return decodeStorageSize(vi.Hardware.StorageSize)
+}
+
+// Decode a BCD byte.
+func bcd(b byte) (int, bool) {
+	hi, lo := b>>4, b&0xf
+	if hi > 9 || lo > 9 {
+		return 0, false
+	}
+
+	return int(hi)*10 + int(lo), true
+}
+
+// Return the production date of the tag, that is the Monday of the ISO 8601
+// production week. A ParameterError is returned if the production date is
+// not valid BCD or not set.
+func (vi DESFireVersionInfo) ProductionDate() (time.Time, error) {
+	week, okWeek := bcd(vi.ProductionWeek)
+	year, okYear := bcd(vi.ProductionYear)
+	if !okWeek || !okYear || week < 1 || week > 53 {
+		return time.Time{}, Error(ParameterError)
+	}
+
+	// January 4 always lies in week 1
+	jan4 := time.Date(2000+year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	monday := jan4.AddDate(0, 0, -((int(jan4.Weekday()) + 6) % 7))
+	return monday.AddDate(0, 0, 7*(week-1)), nil
+}
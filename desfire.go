@@ -27,8 +27,9 @@ package freefare
 import "C"
 import "unsafe"
 
-// DESFire cryptography modes. Compute the bitwise or of these constants and the
-// key number to select a certain cryptography mode.
+import "github.com/clausecker/freefare/sm"
+
+// DESFire cryptography modes as found in DESFireKeySettings.Crypto.
 const (
 	CryptoDES    = 0x00
 	Crypto3k3DES = 0x40
@@ -49,15 +50,53 @@ const (
 // Mifare DESFire tags. As opposed to the libfreefare itself, this wrapper does
 // not provide data-level operations with explicit communication settings.
 // Instead, the wrapper uses the settings stored in the DESFireTag struct or
-// automatically detects them (as if the libfreefare non-ex function was called)
-// if they are set to DEFAULT. When this wrapper creates a new DESFireTag,
-// WriteSettings and ReadSettings are set to DEFAULT so each data access
-// operation behaves like the underlying libfreefare function.
+// automatically detects them if they are set to DEFAULT. When this wrapper
+// creates a new DESFireTag, WriteSettings and ReadSettings are set to DEFAULT.
+//
+// To detect the communication mode of a file, the wrapper calls
+// FileSettings() once and remembers the result until another application is
+// selected or the file is changed or deleted through this wrapper. As with
+// the libfreefare, the communication settings of the file are used if the
+// tag is authenticated with the key named by the access right needed (read
+// or read-write for reading, write or read-write for writing), plain
+// communication otherwise. This makes applications with files of different
+// communication modes usable without changing WriteSettings and ReadSettings
+// between calls. Use Comm() to override the communication mode for a single
+// operation.
 type DESFireTag struct {
 	*tag
 
 	// communication settings
 	WriteSettings, ReadSettings byte
+
+	// state shared among all copies of this DESFireTag
+	state *desfireState
+}
+
+// State kept by the wrapper for a DESFire tag. As DESFireTag is passed around
+// by value, this is kept behind a pointer.
+type desfireState struct {
+	// secure messaging session established by AuthenticateEV2First() or
+	// AuthenticateLRPFirst(), nil if none.
+	ev2 *ev2Session
+
+	// transaction run by Transaction(), nil if none.
+	tx *DESFireTransaction
+
+	// communication modes of the files of the selected application
+	// found so far, see fileModes().
+	files map[byte]fileModes
+
+	// selected application and authentication, see Session().
+	session DESFireSession
+
+	// raw response of the last command protected by secure messaging,
+	// see LastResponse().
+	last *sm.Response
+
+	// real UID found by UIDResolver.Resolve() since the last Connect(),
+	// empty if none.
+	cardUID string
 }
 
 // Get last PCD error. This function wraps mifare_desfire_last_pcd_error(). If
@@ -105,16 +144,25 @@ func (t DESFireTag) resolveEIO() error {
 
 // Connect to a Mifare DESFire tag. This causes the tag to be active.
 func (t DESFireTag) Connect() error {
+	t.dropSession()
+	t.forgetFiles()
+	t.forgetCardUID()
+	t.unselected()
 	r, err := C.mifare_desfire_connect(t.ctag)
 	if r != 0 {
 		return t.TranslateError(err)
 	}
 
+	t.selected(NewDESFireAid(0))
 	return nil
 }
 
 // Disconnect from a Mifare DESFire tag. This causes the tag to be inactive.
 func (t DESFireTag) Disconnect() error {
+	t.dropSession()
+	t.unselected()
+	t.forgetFiles()
+	t.forgetCardUID()
 	r, err := C.mifare_desfire_disconnect(t.ctag)
 	if r != 0 {
 		return t.TranslateError(err)
@@ -128,18 +176,21 @@ func (t DESFireTag) Disconnect() error {
 // mifare_desfire_authenticate_aes() functions as the key type can be deducted
 // from the key.
 func (t DESFireTag) Authenticate(keyNo byte, key DESFireKey) error {
+	t.dropSession()
 	r, err := C.mifare_desfire_authenticate(t.ctag, C.uint8_t(keyNo), key.key)
 	if r == 0 {
+		t.authenticated(AuthLegacy, keyNo, key.keyType, &key)
 		return nil
 	}
 
 	return t.TranslateError(err)
 }
 
-// Change the selected application settings to s. The application number of keys
-// cannot be changed after the application has been created.
-func (t DESFireTag) ChangeKeySettings(s byte) error {
-	r, err := C.mifare_desfire_change_key_settings(t.ctag, C.uint8_t(s))
+// Change the key settings of the selected application to s. The number of
+// keys and their cryptography mode cannot be changed after the application
+// has been created, so s.MaxKeys and s.Crypto are ignored.
+func (t DESFireTag) ChangeKeySettings(s DESFireKeySettings) error {
+	r, err := C.mifare_desfire_change_key_settings(t.ctag, C.uint8_t(s.Marshal()))
 	if r == 0 {
 		return nil
 	}
@@ -147,27 +198,30 @@ func (t DESFireTag) ChangeKeySettings(s byte) error {
 	return t.TranslateError(err)
 }
 
-// Return the key settings and maximum number of keys for the selected
-// application.
-func (t DESFireTag) KeySettings() (settings, maxKeys byte, err error) {
+// Return the key settings including number and cryptography mode of the keys
+// of the selected application.
+func (t DESFireTag) KeySettings() (DESFireKeySettings, error) {
 	var s, mk C.uint8_t
 	r, err := C.mifare_desfire_get_key_settings(t.ctag, &s, &mk)
 	if r != 0 {
-		return 0, 0, t.TranslateError(err)
+		return DESFireKeySettings{}, t.TranslateError(err)
 	}
 
-	settings = byte(s)
-	maxKeys = byte(mk)
-	err = nil
-	return
+	var settings DESFireKeySettings
+	settings.Unmarshal(byte(s), byte(mk))
+	return settings, nil
 }
 
 // Change the key keyNo from oldKey to newKey. Depending on the application
 // settings, a previous authentication with the same key or another key may be
-// required.
+// required. Changing the key authenticated with ends the authentication.
 func (t DESFireTag) ChangeKey(keyNo byte, newKey, oldKey DESFireKey) error {
 	r, err := C.mifare_desfire_change_key(t.ctag, C.uint8_t(keyNo), newKey.key, oldKey.key)
 	if r == 0 {
+		if s := t.Session(); s.Protocol == AuthLegacy && s.KeyNo == keyNo {
+			t.dropSession()
+		}
+
 		return nil
 	}
 
@@ -220,6 +274,7 @@ func (t DESFireTag) DFNames() ([]DESFireDF, error) {
 // authentication with the card master key is required. WARNING: This function
 // is irreversible and will delete all date on the card.
 func (t DESFireTag) FormatPICC() error {
+	t.forgetFiles()
 	r, err := C.mifare_desfire_format_picc(t.ctag)
 	if r != 0 {
 		return t.TranslateError(err)
@@ -228,6 +283,9 @@ func (t DESFireTag) FormatPICC() error {
 	return nil
 }
 
+// Vendor ID of NXP as reported in DESFireVersionInfo.
+const nxpVendorID = 0x04
+
 // Version information for a Mifare DESFire tag.
 type DESFireVersionInfo struct {
 	Hardware, Software struct {
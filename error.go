@@ -64,6 +64,7 @@ const (
 	InvalidTagType
 	MadVersionNotSup // MAD version not supported
 	OverflowError    // EOVERFLOW supplied by KeyDeriver methods
+	UnknownFileType  // file type not known to this wrapper
 )
 
 // error strings for the errors above
@@ -98,6 +99,7 @@ var errorStrings = map[Error]string{
 	InvalidTagType:   "invalid tag type",
 	MadVersionNotSup: "MAD version not supported",
 	OverflowError:    "key data overflow",
+	UnknownFileType:  "unknown file type",
 }
 
 // A MIFARE error. Functions in this library that return an error return either
@@ -0,0 +1,112 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+// Package cmac implements the CMAC message authentication code of NIST SP
+// 800-38B on top of an arbitrary block cipher. Both the 8 byte block ciphers
+// (DES, 3DES) and the 16 byte block ciphers (AES) used by Mifare DESFire tags
+// are supported. The package is internal as its API is tailored to the needs
+// of this module.
+package cmac
+
+import "crypto/cipher"
+
+// Compute the subkeys K1 and K2 for block cipher b.
+func Subkeys(b cipher.Block) (k1, k2 []byte) {
+	l := make([]byte, b.BlockSize())
+	b.Encrypt(l, l)
+	k1 = shift(l)
+	k2 = shift(k1)
+	return
+}
+
+// Multiply a subkey by x in GF(2^n), i.e. shift left by one bit and xor with
+// the reduction polynomial if a bit was shifted out.
+func shift(in []byte) []byte {
+	out := make([]byte, len(in))
+	var carry byte
+	for i := len(in) - 1; i >= 0; i-- {
+		out[i] = in[i]<<1 | carry
+		carry = in[i] >> 7
+	}
+
+	if carry != 0 {
+		if len(in) == 8 {
+			out[len(out)-1] ^= 0x1b
+		} else {
+			out[len(out)-1] ^= 0x87
+		}
+	}
+
+	return out
+}
+
+// Compute the CMAC of msg under block cipher b with an all-zero IV. The
+// result has the length of one cipher block.
+func Sum(b cipher.Block, msg []byte) []byte {
+	return SumIV(b, make([]byte, b.BlockSize()), msg)
+}
+
+// Compute the CMAC of msg under block cipher b, chaining from iv. This is the
+// variant used by DESFire EV1 sessions where the IV carries over from one
+// command to the next. The result has the length of one cipher block.
+func SumIV(b cipher.Block, iv, msg []byte) []byte {
+	bs := b.BlockSize()
+	k1, k2 := Subkeys(b)
+
+	// the last block is the only one that is padded and masked
+	n := (len(msg) + bs - 1) / bs
+	if n == 0 {
+		n = 1
+	}
+
+	last := make([]byte, bs)
+	tail := msg[(n-1)*bs:]
+	copy(last, tail)
+	if len(tail) == bs {
+		xor(last, k1)
+	} else {
+		last[len(tail)] = 0x80
+		xor(last, k2)
+	}
+
+	x := make([]byte, bs)
+	copy(x, iv)
+	for i := 0; i < n-1; i++ {
+		xor(x, msg[i*bs:(i+1)*bs])
+		b.Encrypt(x, x)
+	}
+
+	xor(x, last)
+	b.Encrypt(x, x)
+
+	return x
+}
+
+// Truncate a 16 byte CMAC to 8 bytes by taking the bytes with odd index. This
+// is the truncation used by DESFire EV2 secure messaging and by SDM.
+func Truncate(mac []byte) []byte {
+	t := make([]byte, len(mac)/2)
+	for i := range t {
+		t[i] = mac[2*i+1]
+	}
+
+	return t
+}
+
+// Compute dst ^= src for the first len(dst) bytes.
+func xor(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package cmac
+
+import "bytes"
+import "crypto/aes"
+import "crypto/cipher"
+import "crypto/des"
+import "encoding/hex"
+import "testing"
+
+// Decode a hex string, panicking on malformed input.
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+// The message of the examples in NIST SP 800-38B, appendix D.
+var message = unhex("6bc1bee22e409f96e93d7e117393172a" +
+	"ae2d8a571e03ac9c9eb76fac45af8e51" +
+	"30c81c46a35ce411e5fbc1191a0a52ef" +
+	"f69f2445df4f9b17ad2b417be66c3710")
+
+// Examples of NIST SP 800-38B, appendix D: the CMAC of the first n bytes of
+// message under each cipher.
+var examples = []struct {
+	name string
+	b    func() cipher.Block
+	n    int
+	mac  string
+}{
+	{"AES-128", aes128, 0, "bb1d6929e95937287fa37d129b756746"},
+	{"AES-128", aes128, 16, "070a16b46b4d4144f79bdd9dd04a287c"},
+	{"AES-128", aes128, 40, "dfa66747de9ae63030ca32611497c827"},
+	{"AES-128", aes128, 64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	{"3K3DES", tdea3, 0, "b7a688e122ffaf95"},
+	{"3K3DES", tdea3, 8, "8e8f293136283797"},
+	{"3K3DES", tdea3, 20, "743ddbe0ce2dc2ed"},
+	{"3K3DES", tdea3, 32, "33e6b1092400eae5"},
+}
+
+func aes128() cipher.Block {
+	b, err := aes.NewCipher(unhex("2b7e151628aed2a6abf7158809cf4f3c"))
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+func tdea3() cipher.Block {
+	b, err := des.NewTripleDESCipher(unhex("8aa83bf8cbda1062" + "0bc1bf19fbb6cd58" + "bc313d4a371ca8b5"))
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+func TestSubkeys(t *testing.T) {
+	k1, k2 := Subkeys(aes128())
+	if want := unhex("fbeed618357133667c85e08f7236a8de"); !bytes.Equal(k1, want) {
+		t.Errorf("K1 = %x, want %x", k1, want)
+	}
+
+	if want := unhex("f7ddac306ae266ccf90bc11ee46d513b"); !bytes.Equal(k2, want) {
+		t.Errorf("K2 = %x, want %x", k2, want)
+	}
+}
+
+func TestSum(t *testing.T) {
+	for _, ex := range examples {
+		mac := Sum(ex.b(), message[:ex.n])
+		if want := unhex(ex.mac); !bytes.Equal(mac, want) {
+			t.Errorf("%s, %d bytes: CMAC = %x, want %x", ex.name, ex.n, mac, want)
+		}
+	}
+}
+
+// SumIV with an all zero IV is the plain CMAC; with another IV, it is the
+// CMAC of the message with the IV xored into its first block.
+func TestSumIV(t *testing.T) {
+	b := aes128()
+	iv := make([]byte, aes.BlockSize)
+	if mac := SumIV(b, iv, message); !bytes.Equal(mac, Sum(b, message)) {
+		t.Errorf("SumIV with zero IV = %x, want %x", mac, Sum(b, message))
+	}
+
+	copy(iv, message[:16])
+	msg := append(make([]byte, 16), message[16:]...)
+	if mac := SumIV(b, iv, msg); !bytes.Equal(mac, Sum(b, message)) {
+		t.Errorf("SumIV = %x, want %x", mac, Sum(b, message))
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	mac := Truncate(unhex("00112233445566778899aabbccddeeff"))
+	if want := unhex("1133557799bbddff"); !bytes.Equal(mac, want) {
+		t.Errorf("Truncate = %x, want %x", mac, want)
+	}
+}
@@ -33,6 +33,7 @@ const (
 type MifareKeyDeriver struct {
 	tag     *tag
 	deriver C.MifareKeyDeriver
+	keyType MifareKeyType
 	*finalizee
 }
 
@@ -96,7 +97,7 @@ func (d *MifareKeyDeriver) End() (*DESFireKey, error) {
 		return nil, d.tag.TranslateError(err)
 	}
 
-	return wrapDESFireKey(key), nil
+	return wrapDESFireKey(key, d.keyType), nil
 }
 
 // Mark the end of a derivation and store the new diversified key
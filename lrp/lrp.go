@@ -0,0 +1,213 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+// Package lrp implements the Leakage Resilient Primitive (LRP) as specified
+// in NXP application note AN12304 along with the LRICB encryption mode and
+// CMAC-LRP. LRP is used by NTAG 424 DNA and Mifare DESFire EV3 tags in LRP
+// mode as a replacement for plain AES. The parameters of the NXP profile are
+// used throughout: AES-128 as the underlying block cipher and m = 4, i.e. 16
+// plaintexts and one nibble of input per step.
+package lrp
+
+import "crypto/aes"
+import "crypto/cipher"
+import "errors"
+
+import "github.com/clausecker/freefare/internal/cmac"
+
+// Size of LRP keys, inputs and outputs in bytes.
+const BlockSize = aes.BlockSize
+
+// Number of plaintexts, 2^m for m = 4.
+const numPlaintexts = 16
+
+// ErrKeySize is returned if a key does not have length BlockSize.
+var ErrKeySize = errors.New("lrp: key must be 16 bytes long")
+
+// ErrLength is returned by the LRICB functions if the data is not a
+// multiple of BlockSize.
+var ErrLength = errors.New("lrp: data is not a multiple of the block size")
+
+var (
+	const55 = [BlockSize]byte{
+		0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
+		0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
+	}
+	constAA = [BlockSize]byte{
+		0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa,
+		0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa,
+	}
+	const00 [BlockSize]byte
+)
+
+// Encrypt one block in with key k. As LRP changes the key in every step, no
+// key schedules are kept around.
+func encrypt(k, in []byte) []byte {
+	b, err := aes.NewCipher(k)
+	if err != nil {
+		panic(err) // keys are always 16 bytes here
+	}
+
+	out := make([]byte, BlockSize)
+	b.Encrypt(out, in)
+	return out
+}
+
+// Compute the plaintexts P_0 ... P_15 from the secret key (algorithm 1 of
+// AN12304).
+func GeneratePlaintexts(key []byte) ([numPlaintexts][BlockSize]byte, error) {
+	var p [numPlaintexts][BlockSize]byte
+	if len(key) != BlockSize {
+		return p, ErrKeySize
+	}
+
+	h := encrypt(key, const55[:])
+	for i := range p {
+		copy(p[i][:], encrypt(h, constAA[:]))
+		h = encrypt(h, const55[:])
+	}
+
+	return p, nil
+}
+
+// Compute the first n updated keys from the secret key (algorithm 2 of
+// AN12304).
+func GenerateUpdatedKeys(key []byte, n int) ([][BlockSize]byte, error) {
+	if len(key) != BlockSize {
+		return nil, ErrKeySize
+	}
+
+	uk := make([][BlockSize]byte, n)
+	h := encrypt(key, constAA[:])
+	for i := range uk {
+		copy(uk[i][:], encrypt(h, constAA[:]))
+		h = encrypt(h, const55[:])
+	}
+
+	return uk, nil
+}
+
+// An LRP instance: the plaintexts derived from a secret key together with one
+// of the updated keys derived from the same secret key.
+type LRP struct {
+	p  [numPlaintexts][BlockSize]byte
+	uk [BlockSize]byte
+}
+
+// Create an LRP instance from the secret key key using the updated key with
+// index updatedKey. AN12304 mostly uses updated key 0 for MACs and updated key
+// 1 for encryption.
+func New(key []byte, updatedKey int) (*LRP, error) {
+	p, err := GeneratePlaintexts(key)
+	if err != nil {
+		return nil, err
+	}
+
+	uk, err := GenerateUpdatedKeys(key, updatedKey+1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LRP{p: p, uk: uk[updatedKey]}, nil
+}
+
+// Evaluate LRP on input x, processing one nibble at a time, most significant
+// nibble first (algorithm 3 of AN12304). If final is set, the finalization
+// step is performed. x may have any length.
+func (l *LRP) Eval(x []byte, final bool) []byte {
+	y := l.uk[:]
+	for _, b := range x {
+		y = encrypt(y, l.p[b>>4][:])
+		y = encrypt(y, l.p[b&0xf][:])
+	}
+
+	if final {
+		y = encrypt(y, const00[:])
+	}
+
+	return y
+}
+
+// Increment a big endian counter in place, wrapping around on overflow.
+func increment(ctr []byte) {
+	for i := len(ctr) - 1; i >= 0; i-- {
+		ctr[i]++
+		if ctr[i] != 0 {
+			return
+		}
+	}
+}
+
+// Encrypt src into dst in LRICB mode (algorithm 4 of AN12304) using counter
+// as the initial counter value. counter is advanced by one for each block so
+// consecutive calls continue the key stream. src must be a multiple of
+// BlockSize long, padding is the caller's responsibility. dst and src may
+// overlap entirely.
+func (l *LRP) EncryptLRICB(counter, dst, src []byte) error {
+	if len(src)%BlockSize != 0 || len(dst) < len(src) {
+		return ErrLength
+	}
+
+	for i := 0; i < len(src); i += BlockSize {
+		k := l.Eval(counter, true)
+		b, _ := aes.NewCipher(k)
+		b.Encrypt(dst[i:i+BlockSize], src[i:i+BlockSize])
+		increment(counter)
+	}
+
+	return nil
+}
+
+// Decrypt src into dst in LRICB mode, the inverse of EncryptLRICB.
+func (l *LRP) DecryptLRICB(counter, dst, src []byte) error {
+	if len(src)%BlockSize != 0 || len(dst) < len(src) {
+		return ErrLength
+	}
+
+	for i := 0; i < len(src); i += BlockSize {
+		k := l.Eval(counter, true)
+		b, _ := aes.NewCipher(k)
+		b.Decrypt(dst[i:i+BlockSize], src[i:i+BlockSize])
+		increment(counter)
+	}
+
+	return nil
+}
+
+// Compute CMAC-LRP of msg (algorithms 5 and 6 of AN12304), i.e. CMAC with
+// the block cipher replaced by the finalized LRP evaluation. The full 16 byte
+// MAC is returned.
+func (l *LRP) CMAC(msg []byte) []byte {
+	return cmac.Sum(prf{l}, msg)
+}
+
+// Adapter to make LRP look like a block cipher to package cmac. LRP is a
+// pseudo random function, so only the forward direction is available.
+type prf struct {
+	l *LRP
+}
+
+func (p prf) BlockSize() int {
+	return BlockSize
+}
+
+func (p prf) Encrypt(dst, src []byte) {
+	copy(dst, p.l.Eval(src[:BlockSize], true))
+}
+
+func (p prf) Decrypt(dst, src []byte) {
+	panic("lrp: LRP cannot be inverted")
+}
+
+var _ cipher.Block = prf{}
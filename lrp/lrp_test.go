@@ -0,0 +1,120 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package lrp
+
+import "bytes"
+import "encoding/hex"
+import "testing"
+
+// Decode a hex string, panicking on malformed input.
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+// Create an LRP instance, failing the test on error.
+func newLRP(t *testing.T, key string, updatedKey int) *LRP {
+	l, err := New(unhex(key), updatedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l
+}
+
+// AN12304, example of algorithm 1.
+func TestGeneratePlaintexts(t *testing.T) {
+	p, err := GeneratePlaintexts(unhex("567826B8DA8E768432A9548DBE4AA3A0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := unhex("AC20D39F5341FE98DFCA21DA86BA7914"); !bytes.Equal(p[0][:], want) {
+		t.Errorf("P0 = %X, want %X", p[0], want)
+	}
+}
+
+// AN12304, examples of algorithm 3.
+func TestEval(t *testing.T) {
+	examples := []struct {
+		key        string
+		updatedKey int
+		x, y       string
+	}{
+		{"567826B8DA8E768432A9548DBE4AA3A0", 2, "1359", "1BA2C0C578996BC497DD181C6885A9DD"},
+		{"88B95581002057A93E421EFE4076338B", 2, "77299D", "E9C04556A214AC3297B83E4BDF46F142"},
+	}
+
+	for _, ex := range examples {
+		y := newLRP(t, ex.key, ex.updatedKey).Eval(unhex(ex.x), true)
+		if want := unhex(ex.y); !bytes.Equal(y, want) {
+			t.Errorf("key %s, x = %s: y = %X, want %X", ex.key, ex.x, y, want)
+		}
+	}
+}
+
+// AN12304, example of algorithm 4 with the plaintext padded by the caller.
+func TestLRICB(t *testing.T) {
+	l := newLRP(t, "E0C4935FF0C254CD2CEF8FDDC32460CF", 0)
+	plain := unhex("012D7F1653CAF6503C6AB0C1010E8CB0" + "80000000000000000000000000000000")
+	want := unhex("FCBBACAA4F29182464F99DE41085266F" + "480E863E487BAAF687B43ED1ECE0D623")
+
+	counter := unhex("C3315DBF")
+	enc := make([]byte, len(plain))
+	err := l.EncryptLRICB(counter, enc, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(enc, want) {
+		t.Errorf("ciphertext = %X, want %X", enc, want)
+	}
+
+	counter = unhex("C3315DBF")
+	dec := make([]byte, len(enc))
+	err = l.DecryptLRICB(counter, dec, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(dec, plain) {
+		t.Errorf("plaintext = %X, want %X", dec, plain)
+	}
+
+	if l.EncryptLRICB(counter, enc[:5], plain[:5]) != ErrLength {
+		t.Error("partial block not rejected")
+	}
+}
+
+// AN12304, examples of algorithms 5 and 6.
+func TestCMAC(t *testing.T) {
+	examples := []struct {
+		key, msg, mac string
+	}{
+		{"8195088CE6C393708EBBE6C7914ECB0B", "BBD5B85772C7", "AD8595E0B49C5C0DB18E77355F5AAFF6"},
+		{"5AA9F6C6DE5138113DF5D6B6C77D5D52", "A4434D740C2CB665FE5396959189383F", "8B43ADF767E46B692E8F24E837CB5EFC"},
+	}
+
+	for _, ex := range examples {
+		mac := newLRP(t, ex.key, 0).CMAC(unhex(ex.msg))
+		if want := unhex(ex.mac); !bytes.Equal(mac, want) {
+			t.Errorf("key %s, message %s: CMAC = %X, want %X", ex.key, ex.msg, mac, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package freefare
+
+// Hardware type reported by NTAG 424 DNA tags in Version().
+const ntag424VersionType = 0x04
+
+// DF name of the NDEF application of NTAG 424 DNA tags.
+var ntag424DFName = []byte{0xd2, 0x76, 0x00, 0x00, 0x85, 0x01, 0x01}
+
+// Convert a DESFireTag into an NTAG424Tag to access functionality available
+// for NTAG 424 DNA tags. These tags speak a subset of the DESFire EV2 command
+// set with a single, fixed application and ISO file access. As the libfreefare
+// does not know about these tags, all commands are implemented natively and
+// require a secure messaging session established with AuthenticateEV2First()
+// or, after EnableLRP(), AuthenticateLRPFirst() for anything but plain
+// communication.
+type NTAG424Tag struct {
+	ev2Tag
+}
+
+// Check if t is an NTAG 424 DNA tag and return it as an NTAG424Tag. This
+// function calls Version() and thus must be called while connected, before
+// any secure messaging session is established. If t is not an NTAG 424 tag,
+// an InvalidTagType error is returned.
+func (t DESFireTag) NTAG424() (NTAG424Tag, error) {
+	vi, err := t.Version()
+	if err != nil {
+		return NTAG424Tag{}, err
+	}
+
+	if vi.Hardware.VendorID != nxpVendorID || vi.Hardware.Type != ntag424VersionType {
+		return NTAG424Tag{}, Error(InvalidTagType)
+	}
+
+	return NTAG424Tag{ev2Tag{t}}, nil
+}
+
+// Select the NDEF application of the tag using ISOSelectFile. This must be
+// done before authenticating with an application key. Selecting drops the
+// secure messaging session.
+func (t NTAG424Tag) SelectApplication() error {
+	return t.selectDFName(ntag424DFName)
+}
+
+// Switch the tag to LRP mode. From then on, only AuthenticateLRPFirst() can
+// be used to authenticate. WARNING: this is irreversible. This requires a
+// secure messaging session authenticated with the application master key.
+func (t NTAG424Tag) EnableLRP() error {
+	return t.Configure(CapabilityConfiguration{LRP: true})
+}
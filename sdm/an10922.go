@@ -0,0 +1,66 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package sdm
+
+import "crypto/aes"
+import "errors"
+
+import "github.com/clausecker/freefare/internal/cmac"
+
+// ErrDiversification is returned by DiversifyAES128 if the diversification
+// input is too long.
+var ErrDiversification = errors.New("sdm: diversification input longer than 31 bytes")
+
+// Diversify the AES-128 key masterKey with the diversification input m
+// according to AN10922, the same algorithm as used by the freefare
+// MifareKeyDeriver. Usually m is the UID of the tag followed by the AID and a
+// system identifier. m must not be longer than 31 bytes. This function can be
+// used as a building block for Verifier.FileReadKey.
+func DiversifyAES128(masterKey, m []byte) ([]byte, error) {
+	b, err := newCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(m) > 31 {
+		return nil, ErrDiversification
+	}
+
+	// Unlike plain CMAC, AN10922 always pads to two full blocks.
+	k1, k2 := cmac.Subkeys(b)
+	d := make([]byte, 2*aes.BlockSize)
+	d[0] = 0x01
+	copy(d[1:], m)
+	k := k1
+	if len(m) < 31 {
+		d[1+len(m)] = 0x80
+		k = k2
+	}
+
+	for i := range k {
+		d[aes.BlockSize+i] ^= k[i]
+	}
+
+	mac := make([]byte, aes.BlockSize)
+	for i := 0; i < len(d); i += aes.BlockSize {
+		for j := range mac {
+			mac[j] ^= d[i+j]
+		}
+
+		b.Encrypt(mac, mac)
+	}
+
+	return mac, nil
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package sdm
+
+import "bytes"
+import "encoding/hex"
+import "net/url"
+import "testing"
+
+// Decode a hex string, panicking on malformed input.
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+// All examples of AN12196 use all zero SDM meta read and file read keys.
+var zeroKey = make([]byte, 16)
+
+// AN12196, SUN message with encrypted PICC data and SDMMAC over the empty
+// string: https://choose.url.com/ntag424?e=EF963FF7...&c=94EED9EE65337086
+func TestDecryptPICCData(t *testing.T) {
+	pd, err := DecryptPICCData(zeroKey, unhex("EF963FF7828658A599F3041510671E88"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := unhex("04DE5F1EACC040"); !bytes.Equal(pd.UID, want) {
+		t.Errorf("UID = %X, want %X", pd.UID, want)
+	}
+
+	if !pd.HasCounter || pd.ReadCounter != 61 {
+		t.Errorf("read counter = %d (%v), want 61", pd.ReadCounter, pd.HasCounter)
+	}
+}
+
+func TestSessionKeys(t *testing.T) {
+	pd := PICCData{UID: unhex("04DE5F1EACC040"), ReadCounter: 61, HasCounter: true}
+	_, macKey, err := SessionKeys(zeroKey, pd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := unhex("3FB5F6E3A807A03D5E3570ACE393776F"); !bytes.Equal(macKey, want) {
+		t.Errorf("KSesSDMFileReadMAC = %X, want %X", macKey, want)
+	}
+
+	mac, err := ComputeMAC(macKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := unhex("94EED9EE65337086"); !bytes.Equal(mac, want) {
+		t.Errorf("SDMMAC = %X, want %X", mac, want)
+	}
+}
+
+// AN12196, SUN message with encrypted PICC data, encrypted file data, and
+// SDMMAC over the encrypted file data.
+func TestVerifyURL(t *testing.T) {
+	u, err := url.Parse("https://www.my424dnatag.com/?picc_data=FD91EC264309878BE6345CBE53BADF40" +
+		"&enc=CEE9A53E3E463EF1F459635736738962&cmac=ECC1E7F6C6C73BF6")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ParseURL(u, DefaultParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "CEE9A53E3E463EF1F459635736738962&cmac="; string(m.MACInput) != want {
+		t.Errorf("MAC input = %q, want %q", m.MACInput, want)
+	}
+
+	counters := new(MemoryCounterStore)
+	v := Verifier{MetaReadKey: zeroKey, FileReadKey: StaticKey(zeroKey), Counters: counters}
+	res, err := v.Verify(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := unhex("04958CAA5C5E80"); !bytes.Equal(res.UID, want) {
+		t.Errorf("UID = %X, want %X", res.UID, want)
+	}
+
+	if res.ReadCounter != 8 {
+		t.Errorf("read counter = %d, want 8", res.ReadCounter)
+	}
+
+	if want := "xxxxxxxxxxxxxxxx"; string(res.FileData) != want {
+		t.Errorf("file data = %q, want %q", res.FileData, want)
+	}
+
+	// the same message again is a replay
+	_, err = v.Verify(m)
+	if err != ErrReplay {
+		t.Errorf("replayed message: err = %v, want %v", err, ErrReplay)
+	}
+
+	// a flipped bit in the MAC input must be detected
+	m.MACInput[0] ^= 1
+	_, err = v.Verify(m)
+	if err != ErrMAC {
+		t.Errorf("modified message: err = %v, want %v", err, ErrMAC)
+	}
+}
+
+// AN10922, AES-128 key diversification example.
+func TestDiversifyAES128(t *testing.T) {
+	m := unhex("04782E21801D80" + "3042F5" + "4E585020416275")
+	key, err := DiversifyAES128(unhex("00112233445566778899AABBCCDDEEFF"), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := unhex("A8DD63A3B89D54B37CA802473FDA9175"); !bytes.Equal(key, want) {
+		t.Errorf("diversified key = %X, want %X", key, want)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package sdm
+
+import "encoding/hex"
+import "errors"
+import "net/url"
+import "strings"
+
+// Names of the query parameters the tag mirrors its data into. These are the
+// names configured in the NDEF template when personalizing the tag.
+type Params struct {
+	PICCData string // e.g. "picc_data"
+	EncData  string // e.g. "enc", empty if file data is not encrypted
+	MAC      string // e.g. "cmac"
+}
+
+// The parameter names used throughout AN12196.
+var DefaultParams = Params{
+	PICCData: "picc_data",
+	EncData:  "enc",
+	MAC:      "cmac",
+}
+
+// ErrURL is returned by ParseURL if a parameter is missing or malformed.
+var ErrURL = errors.New("sdm: malformed or incomplete SDM URL")
+
+// Split the query of a tap URL into a Message. It is assumed that the tag
+// was configured the usual way: SDMMACInputOffset points to the beginning of
+// the encrypted file data if present (so the MAC covers the text from there
+// up to and including the "=" of the MAC parameter) or coincides with
+// SDMMACOffset otherwise (so the MAC is computed over the empty string). For
+// other layouts, build the Message yourself.
+func ParseURL(u *url.URL, p Params) (Message, error) {
+	var m Message
+	var err error
+
+	raw := u.RawQuery
+	q, err := url.ParseQuery(raw)
+	if err != nil {
+		return Message{}, ErrURL
+	}
+
+	m.PICCData, err = hexParam(q, p.PICCData)
+	if err != nil {
+		return Message{}, err
+	}
+
+	m.MAC, err = hexParam(q, p.MAC)
+	if err != nil {
+		return Message{}, err
+	}
+
+	macTag := p.MAC + "="
+	macAt := paramIndex(raw, macTag)
+	if macAt < 0 {
+		return Message{}, ErrURL
+	}
+
+	m.MACInput = []byte{}
+	if p.EncData != "" && q.Has(p.EncData) {
+		m.EncFileData, err = hexParam(q, p.EncData)
+		if err != nil {
+			return Message{}, err
+		}
+
+		encAt := paramIndex(raw, p.EncData+"=")
+		if encAt < 0 || encAt > macAt {
+			return Message{}, ErrURL
+		}
+
+		encAt += len(p.EncData) + 1
+		m.MACInput = []byte(raw[encAt : macAt+len(macTag)])
+	}
+
+	return m, nil
+}
+
+// Find the position of the parameter starting with prefix in the raw query.
+func paramIndex(raw, prefix string) int {
+	if strings.HasPrefix(raw, prefix) {
+		return 0
+	}
+
+	i := strings.Index(raw, "&"+prefix)
+	if i < 0 {
+		return -1
+	}
+
+	return i + 1
+}
+
+// Fetch and hex decode a query parameter.
+func hexParam(q url.Values, name string) ([]byte, error) {
+	if !q.Has(name) {
+		return nil, ErrURL
+	}
+
+	b, err := hex.DecodeString(q.Get(name))
+	if err != nil {
+		return nil, ErrURL
+	}
+
+	return b, nil
+}
@@ -0,0 +1,369 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+// Package sm verifies the MACs of Mifare DESFire responses offline, i.e.
+// long after the response was received and without the tag. This makes it
+// possible to archive the raw response to a read in Maced mode and later
+// prove that it came from a tag knowing the key. Responses in Enciphered mode
+// are not covered: their MAC is computed over the ciphertext, so verifying it
+// says nothing about the plaintext without the session encryption key.
+//
+// Responses received in Maced mode through an EV2 or LRP secure messaging
+// session of the freefare package are captured by DESFireTag.LastResponse()
+// as a Response carrying everything needed for verification. For responses
+// captured by other means, this package offers verifiers for the EV2 and LRP
+// response MACs, the CMAC of DESFire EV1 sessions, and the 4 byte MAC of
+// legacy sessions. For EV1 and legacy sessions, the caller supplies the
+// session key in Response.MACKey. This package is pure Go; no libfreefare or
+// libnfc is needed.
+package sm
+
+import "crypto/aes"
+import "crypto/cipher"
+import "crypto/des"
+import "crypto/subtle"
+import "encoding/binary"
+import "errors"
+
+import "github.com/clausecker/freefare/internal/cmac"
+import "github.com/clausecker/freefare/lrp"
+
+// Errors returned by this package.
+var (
+	ErrCipher   = errors.New("sm: unknown cipher")
+	ErrKeySize  = errors.New("sm: key must be 16 bytes long")
+	ErrLength   = errors.New("sm: response too short")
+	ErrMAC      = errors.New("sm: MAC mismatch")
+	ErrProtocol = errors.New("sm: unknown protocol")
+	ErrRandom   = errors.New("sm: authentication random numbers missing")
+)
+
+// Secure messaging protocols as found in Response.Protocol
+const (
+	EV2    = iota // EV2 secure messaging (AuthenticateEV2First)
+	LRP           // LRP secure messaging (AuthenticateLRPFirst)
+	EV1           // EV1 session with CMAC (AES or 3K3DES Authenticate)
+	Legacy        // legacy session (DES or 2K3DES Authenticate)
+)
+
+// Ciphers of EV1 and legacy session keys as found in Response.Cipher. The
+// values are those of freefare.MifareKeyType.
+const (
+	CipherDES = iota
+	Cipher2K3DES
+	Cipher3K3DES
+	CipherAES
+)
+
+// Length of the truncated MAC of EV2 and LRP secure messaging.
+const MACSize = 8
+
+// The raw response to a command together with the session information needed
+// to verify its MAC. Data is the response data as received from the tag,
+// followed by the MAC.
+//
+// MACKey is the session MAC key for EV2, the session master key (from which
+// the MAC and encryption keys are derived) for LRP, and the session key for
+// EV1 and legacy sessions, where Cipher says what kind of key it is. RndA and
+// RndB are the random numbers of the EV2 or LRP authentication that
+// established the session keys; with them, VerifyWithKey() derives the
+// session keys from the key authenticated with instead of trusting MACKey.
+// TI and Counter are the transaction identifier and command counter of EV2
+// and LRP sessions. IV is the CMAC IV for the response in an EV1 session. As
+// anybody who knows MACKey can compute MACs for the session, a Response
+// verified with Verify() only proves that it was not modified since it was
+// archived.
+type Response struct {
+	Protocol int     `json:"protocol"`
+	Cipher   int     `json:"cipher,omitempty"`
+	MACKey   []byte  `json:"mac_key"`
+	RndA     []byte  `json:"rnd_a,omitempty"`
+	RndB     []byte  `json:"rnd_b,omitempty"`
+	TI       [4]byte `json:"ti"`
+	Counter  uint16  `json:"counter"` // command counter of the response
+	IV       []byte  `json:"iv,omitempty"`
+	Status   byte    `json:"status"`
+	Data     []byte  `json:"data"`
+}
+
+// Verify the MAC of r with r.MACKey and return the response data without
+// the MAC.
+func (r *Response) Verify() ([]byte, error) {
+	switch r.Protocol {
+	case EV2:
+		return VerifyEV2(r.MACKey, r.TI, r.Counter, r.Status, r.Data)
+	case LRP:
+		return VerifyLRP(r.MACKey, r.TI, r.Counter, r.Status, r.Data)
+	case EV1, Legacy:
+		b, err := NewBlock(r.Cipher, r.MACKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.Protocol == Legacy {
+			return VerifyLegacyMAC(b, r.Data)
+		}
+
+		return VerifyCMAC(b, r.IV, r.Status, r.Data)
+	default:
+		return nil, ErrProtocol
+	}
+}
+
+// Derive the session keys of r from the AES key key authenticated with and
+// r.RndA and r.RndB, then verify the MAC of r like Verify(). r.MACKey is
+// ignored. This proves that the response came from a tag knowing key (or
+// from somebody else who knows it). This is only possible for EV2 and LRP
+// sessions; the libfreefare does not keep the random numbers of EV1 and
+// legacy authentications, so ErrRandom is returned for those.
+func (r *Response) VerifyWithKey(key []byte) ([]byte, error) {
+	if len(r.RndA) != 16 || len(r.RndB) != 16 {
+		return nil, ErrRandom
+	}
+
+	var macKey []byte
+	var err error
+	switch r.Protocol {
+	case EV2:
+		macKey, err = EV2MACKey(key, r.RndA, r.RndB)
+	case LRP:
+		macKey, err = LRPSessionKey(key, r.RndA, r.RndB)
+	default:
+		return nil, ErrProtocol
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rr := *r
+	rr.MACKey = macKey
+	return rr.Verify()
+}
+
+// Compute the 26 byte core of the session vectors used to derive EV2 and LRP
+// session keys from the random numbers of the authentication.
+func sessionVectorCore(rndA, rndB []byte) []byte {
+	sv := make([]byte, 0, 26)
+	sv = append(sv, rndA[0:2]...)
+	for i := 0; i < 6; i++ {
+		sv = append(sv, rndA[2+i]^rndB[i])
+	}
+
+	sv = append(sv, rndB[6:16]...)
+	sv = append(sv, rndA[8:16]...)
+	return sv
+}
+
+// Derive the EV2 session MAC key from the AES key key and the random numbers
+// rndA and rndB of an AuthenticateEV2First or AuthenticateEV2NonFirst
+// authentication.
+func EV2MACKey(key, rndA, rndB []byte) ([]byte, error) {
+	b, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sv2 := append([]byte{0x5a, 0xa5, 0x00, 0x01, 0x00, 0x80}, sessionVectorCore(rndA, rndB)...)
+	return cmac.Sum(b, sv2), nil
+}
+
+// Derive the LRP session master key from the AES key key and the random
+// numbers rndA and rndB of an AuthenticateLRPFirst or
+// AuthenticateLRPNonFirst authentication.
+func LRPSessionKey(key, rndA, rndB []byte) ([]byte, error) {
+	if len(key) != 16 {
+		return nil, ErrKeySize
+	}
+
+	k, err := lrp.New(key, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	sv := append([]byte{0x00, 0x01, 0x00, 0x80}, sessionVectorCore(rndA, rndB)...)
+	sv = append(sv, 0x96, 0x69)
+	return k.CMAC(sv), nil
+}
+
+// Build the message authenticated by the MAC of an EV2 or LRP response:
+// status, command counter, transaction identifier, and response data.
+func responseMessage(ti [4]byte, ctr uint16, status byte, data []byte) []byte {
+	msg := make([]byte, 0, 7+len(data))
+	msg = append(msg, status, 0, 0)
+	binary.LittleEndian.PutUint16(msg[1:3], ctr)
+	msg = append(msg, ti[:]...)
+	return append(msg, data...)
+}
+
+// Split resp into data and the MAC of length n.
+func splitMAC(resp []byte, n int) (data, mac []byte, err error) {
+	if len(resp) < n {
+		return nil, nil, ErrLength
+	}
+
+	return resp[:len(resp)-n], resp[len(resp)-n:], nil
+}
+
+// Verify the MAC at the end of the response resp received in an EV2 secure
+// messaging session with session MAC key macKey, transaction identifier ti,
+// command counter ctr (the counter after the command), and status status.
+// Return the response data without the MAC.
+func VerifyEV2(macKey []byte, ti [4]byte, ctr uint16, status byte, resp []byte) ([]byte, error) {
+	b, err := newCipher(macKey)
+	if err != nil {
+		return nil, err
+	}
+
+	data, mac, err := splitMAC(resp, MACSize)
+	if err != nil {
+		return nil, err
+	}
+
+	want := cmac.Truncate(cmac.Sum(b, responseMessage(ti, ctr, status, data)))
+	if subtle.ConstantTimeCompare(mac, want) != 1 {
+		return nil, ErrMAC
+	}
+
+	return data, nil
+}
+
+// Verify the MAC at the end of the response resp received in an LRP secure
+// messaging session with session master key sessionKey. The other
+// parameters are as with VerifyEV2().
+func VerifyLRP(sessionKey []byte, ti [4]byte, ctr uint16, status byte, resp []byte) ([]byte, error) {
+	if len(sessionKey) != 16 {
+		return nil, ErrKeySize
+	}
+
+	macKey, err := lrp.New(sessionKey, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	data, mac, err := splitMAC(resp, MACSize)
+	if err != nil {
+		return nil, err
+	}
+
+	want := cmac.Truncate(macKey.CMAC(responseMessage(ti, ctr, status, data)))
+	if subtle.ConstantTimeCompare(mac, want) != 1 {
+		return nil, ErrMAC
+	}
+
+	return data, nil
+}
+
+// Verify the CMAC at the end of the response resp received in a DESFire EV1
+// session (AES, 3K3DES, or 2K3DES authenticated with Authenticate()) with
+// session key b and status status. The MAC is the first 8 bytes of the CMAC
+// over the response data and the status. iv is the CMAC IV at the time of the
+// response, which EV1 sessions carry over from one command to the next; it
+// cannot be reconstructed from a single response. Return the response data
+// without the MAC.
+func VerifyCMAC(b cipher.Block, iv []byte, status byte, resp []byte) ([]byte, error) {
+	if len(iv) != b.BlockSize() {
+		return nil, ErrKeySize
+	}
+
+	data, mac, err := splitMAC(resp, MACSize)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := append(append([]byte{}, data...), status)
+	want := cmac.SumIV(b, iv, msg)[:MACSize]
+	if subtle.ConstantTimeCompare(mac, want) != 1 {
+		return nil, ErrMAC
+	}
+
+	return data, nil
+}
+
+// Verify the 4 byte MAC at the end of the response resp received in a
+// legacy DESFire session (DES or 3DES authenticated with Authenticate())
+// with session key b. The MAC is the first 4 bytes of the CBC-MAC over the
+// response data, zero padded to a multiple of the block size (at least one
+// block), with an all zero IV. Return the response data without the MAC.
+func VerifyLegacyMAC(b cipher.Block, resp []byte) ([]byte, error) {
+	data, mac, err := splitMAC(resp, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	bs := b.BlockSize()
+	n := (len(data) + bs - 1) / bs
+	if n == 0 {
+		n = 1
+	}
+
+	padded := make([]byte, n*bs)
+	copy(padded, data)
+
+	x := make([]byte, bs)
+	for i := 0; i < len(padded); i += bs {
+		for j := range x {
+			x[j] ^= padded[i+j]
+		}
+
+		b.Encrypt(x, x)
+	}
+
+	if subtle.ConstantTimeCompare(mac, x[:4]) != 1 {
+		return nil, ErrMAC
+	}
+
+	return data, nil
+}
+
+// Create the block cipher of type kind (one of the Cipher constants) for
+// the EV1 or legacy session key key: 8 bytes for DES, 16 bytes for 2K3DES
+// and AES, 24 bytes for 3K3DES.
+func NewBlock(kind int, key []byte) (cipher.Block, error) {
+	var size int
+	switch kind {
+	case CipherDES:
+		size = 8
+	case Cipher2K3DES, CipherAES:
+		size = 16
+	case Cipher3K3DES:
+		size = 24
+	default:
+		return nil, ErrCipher
+	}
+
+	if len(key) != size {
+		return nil, ErrKeySize
+	}
+
+	switch kind {
+	case CipherDES:
+		return des.NewCipher(key)
+	case Cipher2K3DES:
+		return des.NewTripleDESCipher(append(append([]byte{}, key...), key[:8]...))
+	case Cipher3K3DES:
+		return des.NewTripleDESCipher(key)
+	default:
+		return aes.NewCipher(key)
+	}
+}
+
+// Create an AES cipher for key, which must be 16 bytes long.
+func newCipher(key []byte) (cipher.Block, error) {
+	if len(key) != 16 {
+		return nil, ErrKeySize
+	}
+
+	return aes.NewCipher(key)
+}
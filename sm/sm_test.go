@@ -0,0 +1,45 @@
+// Copyright (c) 2026 Robert Clausecker <fuzxxl@gmail.com>
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Lesser General Public License as published by the
+// Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package sm
+
+import "bytes"
+import "encoding/hex"
+import "testing"
+
+// Decode a hex string, panicking on malformed input.
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+// Session master key derivation of the LRP authentication example of
+// AN12343 with the all zero key.
+func TestLRPSessionKey(t *testing.T) {
+	rndA := unhex("74D7DF6A2CEC0B72B412DE0D2B1117E6")
+	rndB := unhex("56109A31977C855319CD4618C9D2AED2")
+
+	key, err := LRPSessionKey(make([]byte, 16), rndA, rndB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := unhex("132D7E6F35BA861F39B37221214E25A5"); !bytes.Equal(key, want) {
+		t.Errorf("session master key = %X, want %X", key, want)
+	}
+}
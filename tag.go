@@ -68,7 +68,7 @@ func wrapTag(t C.FreefareTag, d nfc.Device, i *C.nfc_target) Tag {
 	case Classic4k:
 		aTag = ClassicTag{tag}
 	case DESFire:
-		aTag = DESFireTag{tag, Default, Default}
+		aTag = DESFireTag{tag, Default, Default, &desfireState{}}
 	case Ntag21x:
 		panic("Ntag_21x tags are not supported")
 	default:
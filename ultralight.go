@@ -129,6 +129,7 @@ func (t UltralightTag) NewAn10922(masterKey DESFireKey, keyType MifareKeyType) (
 
 	kd.tag = t.tag
 	kd.deriver = deriver
+	kd.keyType = keyType
 	kd.finalizee = newFinalizee(unsafe.Pointer(deriver))
 
 	return